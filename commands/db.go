@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/simonwep/genesis/core"
+	"github.com/urfave/cli/v2"
+)
+
+func RecompressDatabase(_ *cli.Context) error {
+	if changed, err := core.RecompressDatabase(); err != nil {
+		return err
+	} else {
+		fmt.Printf("Recompressed %v values\n", changed)
+	}
+
+	return nil
+}
+
+func RotateEncryptionKey(ctx *cli.Context) error {
+	newKey := []byte(ctx.String("new-key"))
+
+	if path := ctx.String("new-key-file"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		newKey = []byte(strings.TrimSpace(string(data)))
+	}
+
+	if err := core.RotateEncryptionKey(newKey); err != nil {
+		return err
+	}
+
+	fmt.Println("Encryption key rotated, update GENESIS_DB_ENCRYPTION_KEY to the new key")
+	return nil
+}
+
+func EncryptDatabase(_ *cli.Context) error {
+	if plainPath, err := core.EncryptDatabase(); err != nil {
+		return err
+	} else {
+		fmt.Printf("Database encrypted, remove the plaintext copy at %v once you verified everything works\n", plainPath)
+	}
+
+	return nil
+}
+
+func MigrateDatabase(ctx *cli.Context) error {
+	result, err := core.MigrateDatabase(ctx.String("from"), ctx.String("to"))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Migrated %v keys: %v users, %v values and %v blacklisted tokens\n", result.Total, result.Users, result.Data, result.Tokens)
+	return nil
+}
+
+func BackupDatabase(ctx *cli.Context) error {
+	path := ctx.Args().First()
+	if path == "" {
+		return errors.New("missing path of the backup")
+	}
+
+	if _, err := core.WriteBackupFile(path, 0, core.Config.AppBackupPassphrase); err != nil {
+		return err
+	}
+
+	fmt.Printf("Database backed up to %v\n", path)
+	return nil
+}
+
+func RestoreDatabase(ctx *cli.Context) error {
+	if location := ctx.String("from"); location != "" {
+		keys, err := core.RestoreBackupFromS3(location)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Restored %v backups: %v\n", len(keys), strings.Join(keys, ", "))
+		return nil
+	}
+
+	paths := ctx.Args().Slice()
+	if len(paths) == 0 {
+		return errors.New("missing path of the backup")
+	}
+
+	if err := core.RestoreBackupFiles(paths); err != nil {
+		return err
+	}
+
+	fmt.Printf("Restored %v backups\n", len(paths))
+	return nil
+}
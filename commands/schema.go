@@ -0,0 +1,62 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/simonwep/genesis/core"
+	"github.com/urfave/cli/v2"
+)
+
+func ListSchemas(_ *cli.Context) error {
+	if schemas, err := core.GetSchemas(); err != nil {
+		return err
+	} else {
+
+		// Print schemas
+		for _, schema := range schemas {
+			if schema.Key != "" {
+				fmt.Printf("Name: %v, Key: %v\n", schema.Name, schema.Key)
+			} else {
+				fmt.Printf("Name: %v, Pattern: %v\n", schema.Name, schema.Pattern)
+			}
+		}
+	}
+
+	return nil
+}
+
+func SetSchema(ctx *cli.Context) error {
+	name, path := ctx.Args().Get(0), ctx.Args().Get(1)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	err = core.SetSchema(core.Schema{
+		Name:    name,
+		Key:     ctx.String("key"),
+		Pattern: ctx.String("pattern"),
+		Schema:  data,
+	})
+
+	if errors.Is(err, core.ErrInvalidSchema) {
+		fmt.Println(err)
+		return nil
+	}
+
+	return err
+}
+
+func RemoveSchema(ctx *cli.Context) error {
+	err := core.DeleteSchema(ctx.Args().Get(0))
+
+	if errors.Is(err, core.ErrSchemaNotFound) {
+		fmt.Println("Schema not found")
+		return nil
+	}
+
+	return err
+}
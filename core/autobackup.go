@@ -0,0 +1,213 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Scheduled backups are written to the backup directory as chains of a full backup followed by incremental ones,
+// a new chain is started daily and after restarts. Only the configured amount of chains is kept, backends without
+// versions write full backups only. Backups are uploaded to S3-compatible object storage too if a bucket is configured.
+
+const (
+	backupChainDuration = 24 * time.Hour
+	backupFilePrefix    = "genesis-"
+	backupFullSuffix    = "-full.backup"
+	backupIncrSuffix    = "-incremental.backup"
+	backupTimeFormat    = "20060102-150405.000"
+)
+
+var (
+	backupMutex sync.Mutex // Held while a backup is written
+	backupChain struct {
+		started time.Time // Zero if the next backup has to be a full one
+		version uint64
+	}
+
+	lastBackupMutex sync.Mutex
+	lastBackup      time.Time
+)
+
+// LastBackup returns when the last scheduled backup has been written successfully, zero if there hasn't been one.
+func LastBackup() time.Time {
+	lastBackupMutex.Lock()
+	defer lastBackupMutex.Unlock()
+	return lastBackup
+}
+
+// RunScheduledBackup writes the next backup of the chain to the backup directory and removes old chains.
+func RunScheduledBackup() error {
+	backupMutex.Lock()
+	defer backupMutex.Unlock()
+
+	now := time.Now().UTC()
+	full := backupChain.started.IsZero() || now.Sub(backupChain.started) >= backupChainDuration
+
+	since, suffix := uint64(0), backupFullSuffix
+	if !full {
+		since, suffix = backupChain.version, backupIncrSuffix
+	}
+
+	if err := os.MkdirAll(Config.AppBackupDir, 0o700); err != nil {
+		return err
+	}
+
+	path := filepath.Join(Config.AppBackupDir, backupFilePrefix+now.Format(backupTimeFormat)+suffix)
+	version, err := WriteBackupFile(path, since, Config.AppBackupPassphrase)
+	if err != nil {
+		backupChain.started = time.Time{} // Start over with a full backup
+		return err
+	}
+
+	if full && version > 0 {
+		backupChain.started, backupChain.version = now, version
+	} else if !full {
+		backupChain.version = max(backupChain.version, version)
+	}
+
+	lastBackupMutex.Lock()
+	lastBackup = now
+	lastBackupMutex.Unlock()
+
+	Logger.Info("backup written", zap.String("path", path), zap.Bool("full", full))
+
+	if err := rotateBackups(); err != nil {
+		return err
+	} else if Config.S3Bucket == "" {
+		return nil
+	} else if err := shipBackup(path); err != nil {
+		backupChain.started = time.Time{} // The remote chain would have a gap otherwise
+		return err
+	}
+
+	return nil
+}
+
+// rotateBackups removes the local chains of backups exceeding the amount to keep.
+func rotateBackups() error {
+	entries, err := os.ReadDir(Config.AppBackupDir)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	for _, name := range expiredBackups(names) {
+		if err := os.Remove(filepath.Join(Config.AppBackupDir, name)); err != nil {
+			return err
+		}
+
+		Logger.Debug("backup removed", zap.String("name", name))
+	}
+
+	return nil
+}
+
+// shipBackup uploads a backup to the configured bucket and removes the remote chains exceeding the amount to keep.
+func shipBackup(path string) error {
+	client, err := newS3Client(Config.S3Bucket)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	key := Config.S3Prefix + filepath.Base(path)
+	if err := client.upload(key, file); err != nil {
+		return err
+	}
+
+	Logger.Info("backup uploaded", zap.String("bucket", Config.S3Bucket), zap.String("key", key))
+
+	keys, err := client.list(Config.S3Prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range expiredBackups(keys) {
+		if err := client.delete(key); err != nil {
+			return err
+		}
+
+		Logger.Debug("remote backup removed", zap.String("key", key))
+	}
+
+	return nil
+}
+
+// expiredBackups returns the backups among names which belong to chains exceeding the amount to keep.
+// Names may be prefixed by a common path, other names are ignored.
+func expiredBackups(names []string) []string {
+	if Config.AppBackupKeep <= 0 {
+		return nil
+	}
+
+	backups := filterBackups(names)
+	var full []string
+
+	for _, name := range backups {
+		if strings.HasSuffix(name, backupFullSuffix) {
+			full = append(full, name)
+		}
+	}
+
+	if int64(len(full)) <= Config.AppBackupKeep {
+		return nil
+	}
+
+	// Names contain the time they've been written at, everything before the oldest chain to keep goes
+	oldest := full[int64(len(full))-Config.AppBackupKeep]
+	return backups[:slices.Index(backups, oldest)]
+}
+
+// backupChainUntil returns the chain of backups among names which ends with last, last being empty for the latest.
+func backupChainUntil(names []string, last string) ([]string, error) {
+	backups := filterBackups(names)
+
+	end := len(backups) - 1
+	if last != "" {
+		end = slices.Index(backups, last)
+	}
+
+	if end < 0 {
+		return nil, ErrKeyNotFound
+	}
+
+	for start := end; start >= 0; start-- {
+		if strings.HasSuffix(backups[start], backupFullSuffix) {
+			return backups[start : end+1], nil
+		}
+	}
+
+	return nil, ErrBackupIncremental
+}
+
+// filterBackups returns the names of backups sorted by the time they've been written at.
+func filterBackups(names []string) []string {
+	var backups []string
+
+	for _, name := range names {
+		if base := name[strings.LastIndex(name, "/")+1:]; strings.HasPrefix(base, backupFilePrefix) &&
+			(strings.HasSuffix(base, backupFullSuffix) || strings.HasSuffix(base, backupIncrSuffix)) {
+			backups = append(backups, name)
+		}
+	}
+
+	slices.Sort(backups)
+	return backups
+}
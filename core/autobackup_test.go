@@ -0,0 +1,149 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// useBackupConfig writes scheduled backups to a temporary directory and starts a new chain.
+func useBackupConfig(t *testing.T) {
+	config := Config
+	t.Cleanup(func() {
+		Config = config
+		backupChain.started, backupChain.version = time.Time{}, 0
+	})
+
+	Config.AppBackupInterval = time.Hour
+	Config.AppBackupDir = t.TempDir()
+	Config.AppBackupKeep = 0
+	Config.AppBackupPassphrase = nil
+	backupChain.started, backupChain.version = time.Time{}, 0
+}
+
+func listBackups(t *testing.T) []string {
+	entries, err := os.ReadDir(Config.AppBackupDir)
+	assert.NoError(t, err)
+
+	paths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		paths = append(paths, filepath.Join(Config.AppBackupDir, entry.Name()))
+	}
+
+	return paths
+}
+
+func TestBackupChain(t *testing.T) {
+	useTestStore(t, dbBackendBadger)
+	useBackupConfig(t)
+	Config.AppBackupPassphrase = []byte("correct horse battery staple")
+
+	// Each backup of a chain only contains the changes since the previous one
+	steps := []func() error{
+		func() error {
+			_, err := SetDataForUser("foo", "a", []byte("1"), WriteOptions{})
+			return err
+		},
+		func() error {
+			_, err := SetDataForUser("foo", "b", []byte("2"), WriteOptions{})
+			return err
+		},
+		func() error {
+			return DeleteDataFromUser("foo", "a", WriteOptions{SkipTrash: true})
+		},
+	}
+
+	states := make([]string, 0, len(steps))
+	for _, step := range steps {
+		assert.NoError(t, step())
+		assert.NoError(t, RunScheduledBackup())
+
+		data, err := GetAllDataFromUser("foo")
+		assert.NoError(t, err)
+		states = append(states, string(data))
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	backups := listBackups(t)
+	if !assert.Len(t, backups, 3) {
+		return
+	}
+
+	assert.True(t, strings.HasSuffix(backups[0], backupFullSuffix))
+	assert.True(t, strings.HasSuffix(backups[1], backupIncrSuffix))
+	assert.True(t, strings.HasSuffix(backups[2], backupIncrSuffix))
+
+	live, err := countPrefixes(db())
+	assert.NoError(t, err)
+
+	// Restoring a part of the chain restores the state at the time of its last backup
+	for i := range backups {
+		useTestStore(t, dbBackendBadger)
+		assert.NoError(t, RestoreBackupFiles(backups[:i+1]))
+
+		data, err := GetAllDataFromUser("foo")
+		assert.NoError(t, err)
+		assert.Equal(t, states[i], string(data))
+	}
+
+	restored, err := countPrefixes(db())
+	assert.NoError(t, err)
+	assert.Equal(t, live, restored)
+
+	// Gaps in the chain are detected before anything is loaded
+	useTestStore(t, dbBackendBadger)
+	assert.ErrorContains(t, RestoreBackupFiles([]string{backups[0], backups[2]}), "are missing")
+	assert.ErrorIs(t, RestoreBackupFiles(backups[1:]), ErrBackupIncremental)
+
+	counts, err := countPrefixes(db())
+	assert.NoError(t, err)
+	assert.Empty(t, counts)
+}
+
+func TestBackupRotation(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend, func(t *testing.T) {
+			useTestStore(t, backend)
+			useBackupConfig(t)
+			Config.AppBackupKeep = 2
+
+			// Three chains of two backups each
+			for i := 0; i < 6; i++ {
+				if i%2 == 0 {
+					backupChain.started = time.Time{}
+				}
+
+				_, err := SetDataForUser("foo", "a", []byte(strings.Repeat("1", i+1)), WriteOptions{})
+				assert.NoError(t, err)
+				assert.NoError(t, RunScheduledBackup())
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			// Backends without versions write full backups only, which are chains of their own
+			backups := listBackups(t)
+			if backend == dbBackendBadger {
+				assert.Len(t, backups, 4)
+			} else {
+				assert.Len(t, backups, 2)
+			}
+
+			if assert.NotEmpty(t, backups) {
+				assert.True(t, strings.HasSuffix(backups[0], backupFullSuffix))
+			}
+
+			chain, err := backupChainUntil(backups, "")
+			assert.NoError(t, err)
+
+			useTestStore(t, backend)
+			assert.NoError(t, RestoreBackupFiles(chain))
+
+			data, err := GetAllDataFromUser("foo")
+			assert.NoError(t, err)
+			assert.Equal(t, "{\"a\":111111}", string(data))
+		})
+	}
+}
@@ -0,0 +1,587 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4/pb"
+	"golang.org/x/crypto/scrypt"
+	"google.golang.org/protobuf/proto"
+)
+
+// Backups contain badger's backup stream, which is a sequence of protobuf encoded lists of keys prefixed by their
+// size, framed by a header and a trailer. The header is the magic, the format version and the version the backup
+// contains the changes after. The trailer is the version of the latest key and a sha256 of everything before it.
+// Backends without versions write all keys with version 1 and return 0 as the latest version.
+
+const (
+	backupMagic         = "GENESISB"
+	backupFormatVersion = uint16(1)
+	backupHeaderSize    = len(backupMagic) + 2 + 8
+	backupTrailerSize   = 8 + sha256.Size
+
+	// Amount of keys per list written by backends without a backup format of their own
+	backupListSize = 1000
+
+	// Meta bit badger marks deleted keys in backups with
+	badgerBitDelete byte = 1 << 0
+)
+
+var (
+	ErrInvalidBackup     = errors.New("not a backup or truncated")
+	ErrBackupVersion     = errors.New("backup has been made by a newer version")
+	ErrBackupChecksum    = errors.New("backup checksum mismatch")
+	ErrRestoreNotEmpty   = errors.New("database is not empty")
+	ErrBackupIncremental = errors.New("backup is incremental, restore the backups it's based on first")
+)
+
+type backupInfo struct {
+	since   uint64 // Contains changes after this version, zero for full backups
+	version uint64 // Latest version contained
+}
+
+// WriteBackup writes a consistent snapshot of all keys changed after the given version, zero for all keys.
+// It returns the version of the latest key, pass it to make an incremental backup later on.
+func WriteBackup(w io.Writer, since uint64) (uint64, error) {
+	checksum := sha256.New()
+	out := io.MultiWriter(w, checksum)
+
+	header := make([]byte, 0, backupHeaderSize)
+	header = append(header, backupMagic...)
+	header = binary.BigEndian.AppendUint16(header, backupFormatVersion)
+	header = binary.BigEndian.AppendUint64(header, since)
+
+	if _, err := out.Write(header); err != nil {
+		return 0, err
+	}
+
+	version, err := db().Backup(out, since)
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := out.Write(binary.BigEndian.AppendUint64(nil, version)); err != nil {
+		return 0, err
+	}
+
+	_, err = w.Write(checksum.Sum(nil))
+	return version, err
+}
+
+// WriteBackupFile is like WriteBackup but writes to path, encrypted if a passphrase is given.
+// The file only appears once it's complete.
+func WriteBackupFile(path string, since uint64, passphrase []byte) (uint64, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), ".genesis-backup-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	buffered := bufio.NewWriter(file)
+	var writer io.WriteCloser = nopWriteCloser{buffered}
+
+	if len(passphrase) > 0 {
+		if writer, err = newSealWriter(buffered, passphrase); err != nil {
+			return 0, err
+		}
+	}
+
+	version, err := WriteBackup(writer, since)
+	if err != nil {
+		return 0, err
+	} else if err := writer.Close(); err != nil {
+		return 0, err
+	} else if err := buffered.Flush(); err != nil {
+		return 0, err
+	} else if err := file.Sync(); err != nil {
+		return 0, err
+	} else if err := file.Close(); err != nil {
+		return 0, err
+	}
+
+	return version, os.Rename(file.Name(), path)
+}
+
+// RestoreBackupFiles loads the given backups in order into an empty database, starting with a full backup
+// followed by incremental ones. All backups are verified before anything is loaded, nothing may use the database.
+// Encrypted backups are decrypted with the configured passphrase into temporary files first.
+func RestoreBackupFiles(paths []string) error {
+	files := make([]*os.File, 0, len(paths))
+	defer func() {
+		for _, file := range files {
+			_ = file.Close()
+		}
+	}()
+
+	var latest uint64
+	payloads := make([]*io.SectionReader, 0, len(paths))
+
+	for i, path := range paths {
+		file, err := openBackupFile(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		files = append(files, file)
+
+		info, payload, err := verifyBackup(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		} else if (i == 0) != (info.since == 0) {
+			return fmt.Errorf("%s: %w", path, ErrBackupIncremental)
+		} else if i > 0 && info.since > latest {
+			return fmt.Errorf("%s: changes after version %v are missing", path, latest)
+		}
+
+		latest = max(latest, info.version)
+		payloads = append(payloads, payload)
+	}
+
+	if counts, err := countPrefixes(db()); err != nil {
+		return err
+	} else if len(counts) > 0 {
+		return ErrRestoreNotEmpty
+	}
+
+	for i, payload := range payloads {
+		if err := db().Load(payload); err != nil {
+			return fmt.Errorf("%s: %w", paths[i], err)
+		}
+	}
+
+	return nil
+}
+
+// openBackupFile opens a backup, encrypted ones are decrypted into a temporary file which is gone once it's closed.
+func openBackupFile(path string) (*os.File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, len(sealedMagic))
+	if _, err := file.ReadAt(magic, 0); err != nil || string(magic) != sealedMagic {
+		return file, nil
+	}
+
+	defer file.Close()
+
+	if len(Config.AppBackupPassphrase) == 0 {
+		return nil, ErrBackupEncrypted
+	}
+
+	plain, err := os.CreateTemp("", "genesis-restore-*")
+	if err != nil {
+		return nil, err
+	}
+
+	// The file stays accessible until it's closed
+	if err := os.Remove(plain.Name()); err != nil {
+		_ = plain.Close()
+		return nil, err
+	} else if err := unsealBackup(file, plain, Config.AppBackupPassphrase); err != nil {
+		_ = plain.Close()
+		return nil, err
+	}
+
+	return plain, nil
+}
+
+// verifyBackup checks the header and checksum of a backup and returns its info and payload.
+func verifyBackup(file *os.File) (*backupInfo, *io.SectionReader, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	size := stat.Size()
+	if size < int64(backupHeaderSize+backupTrailerSize) {
+		return nil, nil, ErrInvalidBackup
+	}
+
+	header := make([]byte, backupHeaderSize)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return nil, nil, err
+	} else if string(header[:len(backupMagic)]) != backupMagic {
+		return nil, nil, ErrInvalidBackup
+	} else if binary.BigEndian.Uint16(header[len(backupMagic):]) > backupFormatVersion {
+		return nil, nil, ErrBackupVersion
+	}
+
+	checksum := sha256.New()
+	if _, err := io.Copy(checksum, io.NewSectionReader(file, 0, size-sha256.Size)); err != nil {
+		return nil, nil, err
+	}
+
+	trailer := make([]byte, backupTrailerSize)
+	if _, err := file.ReadAt(trailer, size-int64(backupTrailerSize)); err != nil {
+		return nil, nil, err
+	} else if !bytes.Equal(trailer[8:], checksum.Sum(nil)) {
+		return nil, nil, ErrBackupChecksum
+	}
+
+	info := &backupInfo{
+		since:   binary.BigEndian.Uint64(header[len(backupMagic)+2:]),
+		version: binary.BigEndian.Uint64(trailer),
+	}
+
+	payload := io.NewSectionReader(file, int64(backupHeaderSize), size-int64(backupHeaderSize+backupTrailerSize))
+	return info, payload, nil
+}
+
+// writeBackupStream writes all keys of txn in badger's backup format, for backends without one of their own.
+func writeBackupStream(txn Txn, w io.Writer) error {
+	it := txn.NewIterator(DefaultIteratorOptions)
+	defer it.Close()
+
+	list := &pb.KVList{}
+
+	flush := func() error {
+		encoded, err := proto.Marshal(list)
+		if err != nil {
+			return err
+		}
+
+		if _, err := w.Write(binary.LittleEndian.AppendUint64(nil, uint64(len(encoded)))); err != nil {
+			return err
+		} else if _, err := w.Write(encoded); err != nil {
+			return err
+		}
+
+		list.Kv = list.Kv[:0]
+		return nil
+	}
+
+	for it.Rewind(); it.Valid(); it.Next() {
+		item := it.Item()
+
+		value, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		kv := &pb.KV{Key: item.KeyCopy(nil), Value: value, Version: 1}
+		if expiresAt := item.ExpiresAt(); !expiresAt.IsZero() {
+			kv.ExpiresAt = uint64(expiresAt.Unix())
+		}
+
+		if list.Kv = append(list.Kv, kv); len(list.Kv) == backupListSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(list.Kv) > 0 {
+		return flush()
+	}
+
+	return nil
+}
+
+// loadBackupStream writes the keys of a backup in badger's format to store, for backends without one of their own.
+// Lists contain the versions of a key from the latest to the oldest, only the latest one is used.
+func loadBackupStream(store Store, r io.Reader) error {
+	reader := bufio.NewReader(r)
+	var previous []byte
+
+	for {
+		var size uint64
+		if err := binary.Read(reader, binary.LittleEndian, &size); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		encoded := make([]byte, size)
+		if _, err := io.ReadFull(reader, encoded); err != nil {
+			return err
+		}
+
+		list := &pb.KVList{}
+		if err := proto.Unmarshal(encoded, list); err != nil {
+			return err
+		}
+
+		err := store.Update(func(txn Txn) error {
+			now := time.Now()
+
+			for _, kv := range list.Kv {
+				if bytes.Equal(kv.Key, previous) {
+					continue
+				}
+
+				previous = kv.Key
+				expiresAt := time.Time{}
+				if kv.ExpiresAt != 0 {
+					expiresAt = time.Unix(int64(kv.ExpiresAt), 0)
+				}
+
+				if (len(kv.Meta) > 0 && kv.Meta[0]&badgerBitDelete != 0) || (!expiresAt.IsZero() && !expiresAt.After(now)) {
+					if err := txn.Delete(kv.Key); err != nil {
+						return err
+					}
+				} else if err := txn.SetEntry(kv.Key, kv.Value, expiresAt); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Backups encrypted with a passphrase start with their own header: the magic, the format version and the salt
+// the key is derived from with scrypt. It's followed by AES-GCM sealed chunks of the backup, each prefixed by its
+// size with the highest bit marking the last one. The header and that bit are authenticated with each chunk.
+
+const (
+	sealedMagic         = "GENESISE"
+	sealedFormatVersion = uint16(1)
+	sealedSaltSize      = 16
+	sealedHeaderSize    = len(sealedMagic) + 2 + sealedSaltSize
+	sealedChunkSize     = 64 << 10 // 64KB
+	sealedLastChunk     = uint32(1 << 31)
+)
+
+var (
+	ErrBackupEncrypted  = errors.New("backup is encrypted, set GENESIS_BACKUP_PASSPHRASE")
+	ErrBackupPassphrase = errors.New("backup is encrypted with a different passphrase or corrupted")
+)
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// sealWriter encrypts everything written to it, it has to be closed to write the last chunk.
+type sealWriter struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	buffer  []byte
+	counter uint64
+}
+
+func newSealWriter(w io.Writer, passphrase []byte) (*sealWriter, error) {
+	header := make([]byte, 0, sealedHeaderSize)
+	header = append(header, sealedMagic...)
+	header = binary.BigEndian.AppendUint16(header, sealedFormatVersion)
+	header = append(header, make([]byte, sealedSaltSize)...)
+
+	if _, err := rand.Read(header[sealedHeaderSize-sealedSaltSize:]); err != nil {
+		return nil, err
+	}
+
+	aead, err := newSealCipher(passphrase, header[sealedHeaderSize-sealedSaltSize:])
+	if err != nil {
+		return nil, err
+	} else if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &sealWriter{w: w, aead: aead, header: header}, nil
+}
+
+func (s *sealWriter) Write(data []byte) (int, error) {
+	s.buffer = append(s.buffer, data...)
+
+	// The last chunk is only sealed on close
+	for len(s.buffer) > sealedChunkSize {
+		if err := s.seal(s.buffer[:sealedChunkSize], false); err != nil {
+			return 0, err
+		}
+
+		s.buffer = s.buffer[sealedChunkSize:]
+	}
+
+	return len(data), nil
+}
+
+func (s *sealWriter) Close() error {
+	return s.seal(s.buffer, true)
+}
+
+func (s *sealWriter) seal(chunk []byte, last bool) error {
+	size := uint32(len(chunk) + s.aead.Overhead())
+	if last {
+		size |= sealedLastChunk
+	}
+
+	sealed := s.aead.Seal(nil, sealNonce(s.aead, s.counter), chunk, sealAdditionalData(s.header, last))
+	s.counter++
+
+	if _, err := s.w.Write(binary.BigEndian.AppendUint32(nil, size)); err != nil {
+		return err
+	}
+
+	_, err := s.w.Write(sealed)
+	return err
+}
+
+// unsealBackup decrypts a backup encrypted by sealWriter from r to w.
+func unsealBackup(r io.Reader, w io.Writer, passphrase []byte) error {
+	header := make([]byte, sealedHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return ErrInvalidBackup
+	} else if string(header[:len(sealedMagic)]) != sealedMagic {
+		return ErrInvalidBackup
+	} else if binary.BigEndian.Uint16(header[len(sealedMagic):]) > sealedFormatVersion {
+		return ErrBackupVersion
+	}
+
+	aead, err := newSealCipher(passphrase, header[sealedHeaderSize-sealedSaltSize:])
+	if err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(r)
+	sealed := make([]byte, sealedChunkSize+aead.Overhead())
+
+	for counter := uint64(0); ; counter++ {
+		var size uint32
+		if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+			return ErrInvalidBackup
+		}
+
+		last := size&sealedLastChunk != 0
+		size &^= sealedLastChunk
+
+		if size > uint32(len(sealed)) || size < uint32(aead.Overhead()) {
+			return ErrInvalidBackup
+		} else if _, err := io.ReadFull(reader, sealed[:size]); err != nil {
+			return ErrInvalidBackup
+		}
+
+		chunk, err := aead.Open(nil, sealNonce(aead, counter), sealed[:size], sealAdditionalData(header, last))
+		if err != nil {
+			return ErrBackupPassphrase
+		} else if _, err := w.Write(chunk); err != nil {
+			return err
+		}
+
+		if last {
+			if _, err := reader.ReadByte(); !errors.Is(err, io.EOF) {
+				return ErrInvalidBackup
+			}
+
+			return nil
+		}
+	}
+}
+
+func newSealCipher(passphrase, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func sealNonce(aead cipher.AEAD, counter uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], counter)
+	return nonce
+}
+
+func sealAdditionalData(header []byte, last bool) []byte {
+	data := append(bytes.Clone(header), 0)
+	if last {
+		data[len(data)-1] = 1
+	}
+
+	return data
+}
+
+// RestoreBackupFromS3 downloads a chain of backups from S3-compatible object storage and restores it like
+// RestoreBackupFiles. The location is given as s3://<bucket>/<key>, the chain ends with the backup stored as key,
+// or the latest one if key is a prefix. Returns the keys of the restored backups.
+func RestoreBackupFromS3(location string) ([]string, error) {
+	parsed, err := url.Parse(location)
+	if err != nil || parsed.Scheme != "s3" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid location %q, must be s3://<bucket>/<key>", location)
+	}
+
+	client, err := newS3Client(parsed.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	key, last := strings.TrimPrefix(parsed.Path, "/"), ""
+	prefix := key
+
+	if strings.HasSuffix(key, backupFullSuffix) || strings.HasSuffix(key, backupIncrSuffix) {
+		prefix, last = key[:strings.LastIndex(key, "/")+1], key
+	}
+
+	keys, err := client.list(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, err := backupChainUntil(keys, last)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, fmt.Errorf("no backups found at %s", location)
+	} else if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "genesis-restore-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	paths := make([]string, 0, len(chain))
+	for _, key := range chain {
+		path := filepath.Join(dir, key[strings.LastIndex(key, "/")+1:])
+		if err := downloadBackup(client, key, path); err != nil {
+			return nil, err
+		}
+
+		paths = append(paths, path)
+	}
+
+	return chain, RestoreBackupFiles(paths)
+}
+
+func downloadBackup(client *s3Client, key, path string) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := client.download(key, file); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,213 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	badgerGCInterval        = time.Hour
+	badgerLoadPendingWrites = 256
+)
+
+type badgerStore struct {
+	db   *badger.DB
+	done chan struct{}
+}
+
+type badgerTxn struct {
+	txn *badger.Txn
+}
+
+type badgerItem struct {
+	item *badger.Item
+}
+
+type badgerIterator struct {
+	it *badger.Iterator
+}
+
+// newBadgerStore wraps db and runs its value log garbage collection until it's closed.
+func newBadgerStore(db *badger.DB) *badgerStore {
+	store := &badgerStore{db: db, done: make(chan struct{})}
+
+	go func() {
+		ticker := time.NewTicker(badgerGCInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-store.done:
+				return
+			case <-ticker.C:
+				if err := db.RunValueLogGC(0.5); err != nil && !errors.Is(err, badger.ErrNoRewrite) {
+					Logger.Error("failed to run value log GC", zap.Error(err))
+				}
+			}
+		}
+	}()
+
+	return store
+}
+
+func openBadger(path string, encryptionKey []byte) (*badger.DB, error) {
+	options := badger.DefaultOptions(path)
+	options.Logger = nil
+
+	// Adjust options for a smaller database
+	options.CompactL0OnClose = true
+	options.ValueLogFileSize = 64 << 20 // 64MB
+	options.NumLevelZeroTables = 1
+	options.NumLevelZeroTablesStall = 2
+
+	// Badger requires a cache for the indices of encrypted tables
+	if len(encryptionKey) > 0 {
+		options.EncryptionKey = encryptionKey
+		options.IndexCacheSize = dbIndexCacheSize
+	}
+
+	return badger.Open(options)
+}
+
+func (s *badgerStore) NewTransaction(update bool) Txn {
+	return &badgerTxn{txn: s.db.NewTransaction(update)}
+}
+
+func (s *badgerStore) View(fn func(txn Txn) error) error {
+	return s.db.View(func(txn *badger.Txn) error {
+		return fn(&badgerTxn{txn: txn})
+	})
+}
+
+func (s *badgerStore) Update(fn func(txn Txn) error) error {
+	return badgerError(s.db.Update(func(txn *badger.Txn) error {
+		return fn(&badgerTxn{txn: txn})
+	}))
+}
+
+func (s *badgerStore) DropAll() error {
+	return s.db.DropAll()
+}
+
+func (s *badgerStore) Backup(w io.Writer, since uint64) (uint64, error) {
+	return s.db.Backup(w, since)
+}
+
+func (s *badgerStore) Load(r io.Reader) error {
+	return s.db.Load(r, badgerLoadPendingWrites)
+}
+
+func (s *badgerStore) Close() error {
+	close(s.done)
+	return s.db.Close()
+}
+
+func (t *badgerTxn) Get(key []byte) (Item, error) {
+	item, err := t.txn.Get(key)
+	if err != nil {
+		return nil, badgerError(err)
+	}
+
+	return &badgerItem{item: item}, nil
+}
+
+func (t *badgerTxn) Set(key, value []byte) error {
+	return badgerError(t.txn.Set(key, value))
+}
+
+func (t *badgerTxn) SetEntry(key, value []byte, expiresAt time.Time) error {
+	entry := badger.NewEntry(key, value)
+
+	if !expiresAt.IsZero() {
+		entry.ExpiresAt = uint64(expiresAt.Unix())
+	}
+
+	return badgerError(t.txn.SetEntry(entry))
+}
+
+func (t *badgerTxn) Delete(key []byte) error {
+	return badgerError(t.txn.Delete(key))
+}
+
+func (t *badgerTxn) NewIterator(opts IteratorOptions) Iterator {
+	options := badger.DefaultIteratorOptions
+	options.PrefetchValues = opts.PrefetchValues
+	return &badgerIterator{it: t.txn.NewIterator(options)}
+}
+
+func (t *badgerTxn) Commit() error {
+	return badgerError(t.txn.Commit())
+}
+
+func (t *badgerTxn) Discard() {
+	t.txn.Discard()
+}
+
+func (i *badgerItem) Key() []byte {
+	return i.item.Key()
+}
+
+func (i *badgerItem) KeyCopy(dst []byte) []byte {
+	return i.item.KeyCopy(dst)
+}
+
+func (i *badgerItem) Value(fn func(val []byte) error) error {
+	return i.item.Value(fn)
+}
+
+func (i *badgerItem) ValueCopy(dst []byte) ([]byte, error) {
+	return i.item.ValueCopy(dst)
+}
+
+func (i *badgerItem) ExpiresAt() time.Time {
+	if expiresAt := i.item.ExpiresAt(); expiresAt != 0 {
+		return time.Unix(int64(expiresAt), 0)
+	}
+
+	return time.Time{}
+}
+
+func (i *badgerIterator) Rewind() {
+	i.it.Rewind()
+}
+
+func (i *badgerIterator) Seek(key []byte) {
+	i.it.Seek(key)
+}
+
+func (i *badgerIterator) Valid() bool {
+	return i.it.Valid()
+}
+
+func (i *badgerIterator) ValidForPrefix(prefix []byte) bool {
+	return i.it.ValidForPrefix(prefix)
+}
+
+func (i *badgerIterator) Next() {
+	i.it.Next()
+}
+
+func (i *badgerIterator) Item() Item {
+	return &badgerItem{item: i.it.Item()}
+}
+
+func (i *badgerIterator) Close() {
+	i.it.Close()
+}
+
+// badgerError translates errors of badger to the ones of Store.
+func badgerError(err error) error {
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return ErrKeyNotFound
+	} else if errors.Is(err, badger.ErrConflict) {
+		return ErrConflict
+	} else if errors.Is(err, badger.ErrTxnTooBig) {
+		return ErrTxnTooBig
+	}
+
+	return err
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrTooManyKeys = errors.New("too many keys")
+
+// BatchOperation either deletes, updates or sets the value of a key.
+type BatchOperation struct {
+	Key     string
+	Delete  bool
+	Update  func(current []byte) ([]byte, error)
+	Data    []byte
+	Options WriteOptions
+}
+
+// BatchError is returned if a single operation of a batch failed.
+type BatchError struct {
+	Index int
+	Err   error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("operation %d failed: %v", e.Index, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// ApplyBatchForUser applies all operations in a single transaction, either all of them succeed or none.
+// The metadata of each set or updated key is returned in the order of the operations.
+func ApplyBatchForUser(name string, operations []BatchOperation) ([]*DataMeta, error) {
+	unlock := lockUser(name)
+	defer unlock()
+
+	var metas, deleted []*DataMeta
+	var values [][]byte
+
+	err := update(func(txn Txn) error {
+		metas = make([]*DataMeta, len(operations))
+		deleted = make([]*DataMeta, len(operations))
+		values = make([][]byte, len(operations))
+
+		for i, op := range operations {
+			var err error
+
+			if op.Delete {
+				deleted[i], err = deleteData(txn, name, op.Key, op.Options)
+			} else if op.Update != nil {
+				metas[i], values[i], err = updateData(txn, name, op.Key, op.Update, op.Options)
+			} else {
+				metas[i], err = setData(txn, name, op.Key, op.Data, op.Options)
+				values[i] = op.Data
+			}
+
+			if err != nil {
+				return &BatchError{Index: i, Err: err}
+			}
+		}
+
+		if countKeys(txn, name) > Config.AppKeysPerUser {
+			return ErrTooManyKeys
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return metas, err
+	}
+
+	for i, op := range operations {
+		if op.Delete {
+			publishDelete(name, op.Key, deleted[i])
+		} else {
+			publishSet(name, op.Key, metas[i], values[i])
+		}
+	}
+
+	return metas, nil
+}
+
+func countKeys(txn Txn, name string) int64 {
+	opts := DefaultIteratorOptions
+	opts.PrefetchValues = false
+
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	prefix := buildUserDataKey(name, "")
+	count := int64(0)
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		count++
+	}
+
+	return count
+}
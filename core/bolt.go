@@ -0,0 +1,294 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+// All keys are kept in a single bucket, values are prefixed with the unix time they expire at or zero.
+// Expired values are skipped while reading and removed periodically.
+
+const (
+	boltSweepInterval = time.Hour
+	boltOpenTimeout   = time.Second
+	boltExpiresSize   = 8
+)
+
+var boltBucket = []byte("genesis")
+
+type boltStore struct {
+	db   *bbolt.DB
+	done chan struct{}
+}
+
+// boltTxn holds the error of a transaction which couldn't be started instead, all operations return it.
+type boltTxn struct {
+	tx  *bbolt.Tx
+	err error
+}
+
+type boltItem struct {
+	key   []byte
+	value []byte // Including the expiration
+}
+
+type boltIterator struct {
+	cursor *bbolt.Cursor
+	key    []byte
+	value  []byte
+}
+
+func openBolt(path string, encryptionKey []byte) (*boltStore, error) {
+	if len(encryptionKey) > 0 {
+		return nil, ErrEncryptionUnsupported
+	} else if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	}); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	store := &boltStore{db: db, done: make(chan struct{})}
+
+	go func() {
+		ticker := time.NewTicker(boltSweepInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-store.done:
+				return
+			case <-ticker.C:
+				if err := store.sweep(); err != nil {
+					Logger.Error("failed to remove expired keys", zap.Error(err))
+				}
+			}
+		}
+	}()
+
+	return store, nil
+}
+
+// sweep removes all expired values.
+func (s *boltStore) sweep() error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		now := time.Now()
+		cursor := tx.Bucket(boltBucket).Cursor()
+
+		for key, value := cursor.First(); key != nil; {
+			if boltAlive(value, now) {
+				key, value = cursor.Next()
+			} else if err := cursor.Delete(); err != nil {
+				return err
+			} else {
+				key, value = cursor.Seek(key) // Deleting moves the cursor
+			}
+		}
+
+		return nil
+	})
+}
+
+// NewTransaction doesn't fail, errors like a closed database are returned by the operations of the transaction instead.
+func (s *boltStore) NewTransaction(update bool) Txn {
+	tx, err := s.db.Begin(update)
+	return &boltTxn{tx: tx, err: err}
+}
+
+func (s *boltStore) View(fn func(txn Txn) error) error {
+	return s.db.View(func(tx *bbolt.Tx) error {
+		return fn(&boltTxn{tx: tx})
+	})
+}
+
+func (s *boltStore) Update(fn func(txn Txn) error) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return fn(&boltTxn{tx: tx})
+	})
+}
+
+func (s *boltStore) DropAll() error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.DeleteBucket(boltBucket); err != nil {
+			return err
+		}
+
+		_, err := tx.CreateBucket(boltBucket)
+		return err
+	})
+}
+
+func (s *boltStore) Backup(w io.Writer, _ uint64) (uint64, error) {
+	return 0, s.View(func(txn Txn) error {
+		return writeBackupStream(txn, w)
+	})
+}
+
+func (s *boltStore) Load(r io.Reader) error {
+	return loadBackupStream(s, r)
+}
+
+func (s *boltStore) Close() error {
+	close(s.done)
+	return s.db.Close()
+}
+
+func (t *boltTxn) Get(key []byte) (Item, error) {
+	if t.err != nil {
+		return nil, t.err
+	}
+
+	value := t.tx.Bucket(boltBucket).Get(key)
+	if value == nil || !boltAlive(value, time.Now()) {
+		return nil, ErrKeyNotFound
+	}
+
+	return &boltItem{key: key, value: value}, nil
+}
+
+func (t *boltTxn) Set(key, value []byte) error {
+	return t.SetEntry(key, value, time.Time{})
+}
+
+func (t *boltTxn) SetEntry(key, value []byte, expiresAt time.Time) error {
+	if t.err != nil {
+		return t.err
+	}
+
+	stored := make([]byte, boltExpiresSize, boltExpiresSize+len(value))
+	if !expiresAt.IsZero() {
+		binary.BigEndian.PutUint64(stored, uint64(expiresAt.Unix()))
+	}
+
+	return t.tx.Bucket(boltBucket).Put(bytes.Clone(key), append(stored, value...))
+}
+
+func (t *boltTxn) Delete(key []byte) error {
+	if t.err != nil {
+		return t.err
+	}
+
+	return t.tx.Bucket(boltBucket).Delete(key)
+}
+
+func (t *boltTxn) NewIterator(IteratorOptions) Iterator {
+	if t.err != nil {
+		return &boltIterator{} // Never valid
+	}
+
+	return &boltIterator{cursor: t.tx.Bucket(boltBucket).Cursor()}
+}
+
+func (t *boltTxn) Commit() error {
+	if t.err != nil {
+		return t.err
+	} else if !t.tx.Writable() {
+		return t.tx.Rollback()
+	}
+
+	return t.tx.Commit()
+}
+
+func (t *boltTxn) Discard() {
+	if t.err == nil {
+		_ = t.tx.Rollback() // Fails if it's been committed already
+	}
+}
+
+func (i *boltItem) Key() []byte {
+	return i.key
+}
+
+func (i *boltItem) KeyCopy(dst []byte) []byte {
+	return append(dst[:0], i.key...)
+}
+
+func (i *boltItem) Value(fn func(val []byte) error) error {
+	return fn(i.value[boltExpiresSize:])
+}
+
+func (i *boltItem) ValueCopy(dst []byte) ([]byte, error) {
+	return append(dst[:0], i.value[boltExpiresSize:]...), nil
+}
+
+func (i *boltItem) ExpiresAt() time.Time {
+	if expiresAt := binary.BigEndian.Uint64(i.value); expiresAt != 0 {
+		return time.Unix(int64(expiresAt), 0)
+	}
+
+	return time.Time{}
+}
+
+func (i *boltIterator) Rewind() {
+	if i.cursor == nil {
+		return
+	}
+
+	i.key, i.value = i.cursor.First()
+	i.skip()
+}
+
+func (i *boltIterator) Seek(key []byte) {
+	if i.cursor == nil {
+		return
+	}
+
+	i.key, i.value = i.cursor.Seek(key)
+	i.skip()
+}
+
+func (i *boltIterator) Valid() bool {
+	return i.key != nil
+}
+
+func (i *boltIterator) ValidForPrefix(prefix []byte) bool {
+	return i.key != nil && bytes.HasPrefix(i.key, prefix)
+}
+
+// Next repositions the cursor first, the current key may have been changed or deleted in the meantime.
+func (i *boltIterator) Next() {
+	current := bytes.Clone(i.key)
+
+	if i.key, i.value = i.cursor.Seek(current); bytes.Equal(i.key, current) {
+		i.key, i.value = i.cursor.Next()
+	}
+
+	i.skip()
+}
+
+func (i *boltIterator) Item() Item {
+	return &boltItem{key: i.key, value: i.value}
+}
+
+func (i *boltIterator) Close() {}
+
+// skip moves the iterator past expired values.
+func (i *boltIterator) skip() {
+	now := time.Now()
+
+	for i.key != nil && !boltAlive(i.value, now) {
+		i.key, i.value = i.cursor.Next()
+	}
+}
+
+func boltAlive(value []byte, now time.Time) bool {
+	expiresAt := binary.BigEndian.Uint64(value)
+	return expiresAt == 0 || int64(expiresAt) > now.Unix()
+}
@@ -0,0 +1,165 @@
+package core
+
+import (
+	"errors"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Values starting with one of these bytes are encoded, all others are stored as they are.
+// None of them can start a JSON document.
+const (
+	encodingZstd byte = 0x01
+)
+
+// Amount of values rewritten per transaction by RecompressDatabase
+const recompressBatchSize = 1000
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// encodeValue compresses data if it's at least as large as the configured threshold and gets smaller by it.
+func encodeValue(data []byte) []byte {
+	if Config.AppCompressionMinSize <= 0 || int64(len(data)) < Config.AppCompressionMinSize {
+		return data
+	}
+
+	compressed := zstdEncoder.EncodeAll(data, []byte{encodingZstd})
+	if len(compressed) >= len(data) {
+		return data
+	}
+
+	return compressed
+}
+
+func decodeValue(data []byte) ([]byte, error) {
+	if len(data) > 0 && data[0] == encodingZstd {
+		return zstdDecoder.DecodeAll(data[1:], nil)
+	}
+
+	return data, nil
+}
+
+// readValue returns a decoded copy of the value of item.
+func readValue(item Item) ([]byte, error) {
+	data, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeValue(data)
+}
+
+// RecompressDatabase re-encodes all stored values according to the current compression threshold
+// and returns the amount of values which changed.
+func RecompressDatabase() (int, error) {
+	changed := 0
+
+	for _, prefix := range [][]byte{
+		[]byte(dbDataPrefix + dbKeySeparator),
+		[]byte(dbHistoryPrefix + dbKeySeparator),
+		[]byte(dbTrashValuePrefix + dbKeySeparator),
+	} {
+		for start := prefix; start != nil; {
+			keys, next, err := listRecompressKeys(prefix, start)
+			if err != nil {
+				return changed, err
+			}
+
+			count := 0
+			if err := update(func(txn Txn) error {
+				count = 0
+
+				for _, key := range keys {
+					if rewritten, err := recompressValue(txn, key); err != nil {
+						return err
+					} else if rewritten {
+						count++
+					}
+				}
+
+				return nil
+			}); err != nil {
+				return changed, err
+			}
+
+			changed += count
+			start = next
+		}
+	}
+
+	return changed, nil
+}
+
+// listRecompressKeys returns up to recompressBatchSize keys below prefix, starting at start, whose values
+// are encoded differently than they would be now, and the key to continue at or nil if there are no more.
+// The read transaction is discarded before the values are rewritten, writes may have to wait for it otherwise.
+func listRecompressKeys(prefix, start []byte) ([][]byte, []byte, error) {
+	txn := db().NewTransaction(false)
+	defer txn.Discard()
+
+	it := txn.NewIterator(DefaultIteratorOptions)
+	defer it.Close()
+
+	keys := make([][]byte, 0)
+
+	for it.Seek(start); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+
+		if len(keys) == recompressBatchSize {
+			return keys, item.KeyCopy(nil), nil
+		} else if outdated, err := isOutdatedEncoding(item); err != nil {
+			return nil, nil, err
+		} else if outdated {
+			keys = append(keys, item.KeyCopy(nil))
+		}
+	}
+
+	return keys, nil, nil
+}
+
+// recompressValue re-encodes the value of key if it's still encoded differently than it would be now.
+// Returns whether it was rewritten, values removed in the meantime are skipped.
+func recompressValue(txn Txn, key []byte) (bool, error) {
+	item, err := txn.Get(key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	stored, err := item.ValueCopy(nil)
+	if err != nil {
+		return false, err
+	}
+
+	data, err := decodeValue(stored)
+	if err != nil {
+		return false, err
+	}
+
+	encoded := encodeValue(data)
+	if string(encoded) == string(stored) {
+		return false, nil
+	}
+
+	return true, txn.SetEntry(key, encoded, item.ExpiresAt())
+}
+
+func isOutdatedEncoding(item Item) (bool, error) {
+	outdated := false
+
+	err := item.Value(func(stored []byte) error {
+		data, err := decodeValue(stored)
+		if err != nil {
+			return err
+		}
+
+		outdated = string(encodeValue(data)) != string(stored)
+		return nil
+	})
+
+	return outdated, err
+}
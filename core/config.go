@@ -12,46 +12,94 @@ import (
 )
 
 type AppConfig struct {
-	DbPath             string
-	BaseUrl            string
-	JWTSecret          []byte
-	JWTExpiration      time.Duration
-	JWTCookieAllowHTTP bool
-	AppBuildVersion    string
-	AppBuildDate       string
-	AppBuildCommit     string
-	AppGinMode         string
-	AppPort            string
-	AppUsersToCreate   []User
-	AppUserPattern     *regexp.Regexp
-	AppKeyPattern      *regexp.Regexp
-	AppDataMaxSize     int64
-	AppKeysPerUser     int64
-	LoginMaxAttempts   int64
-	LoginLockDurations []time.Duration
+	DbBackend             string
+	DbPath                string
+	DbEncryptionKey       []byte
+	BaseUrl               string
+	JWTSecret             []byte
+	JWTExpiration         time.Duration
+	JWTCookieAllowHTTP    bool
+	AppBuildVersion       string
+	AppBuildDate          string
+	AppBuildCommit        string
+	AppGinMode            string
+	AppPort               string
+	AppUsersToCreate      []User
+	AppUserPattern        *regexp.Regexp
+	AppKeyPattern         *regexp.Regexp
+	AppDataMaxSize        int64
+	AppKeysPerUser        int64
+	AppBatchMaxSize       int64
+	AppQuotaPerUser       int64
+	AppHistorySize        int64
+	AppHistoryMaxSize     int64
+	AppEventsBufferSize   int64
+	AppTombstoneRetention time.Duration
+	AppCompressionMinSize int64
+	AppTrashRetention     time.Duration
+	AppTrashMaxSize       int64
+	AppCacheControl       string
+	AppIdempotencyTTL     time.Duration
+	AppBackupInterval     time.Duration
+	AppBackupDir          string
+	AppBackupKeep         int64
+	AppBackupPassphrase   []byte
+	LoginMaxAttempts      int64
+	LoginLockDurations    []time.Duration
+	S3Endpoint            string
+	S3Region              string
+	S3Bucket              string
+	S3Prefix              string
+	S3AccessKey           string
+	S3SecretKey           string
+	S3PartSize            int64
 }
 
 var Config = func() AppConfig {
 	config := AppConfig{
-		DbPath:             resolvePath(env("GENESIS_DB_PATH")),
-		BaseUrl:            env("GENESIS_BASE_URL"),
-		JWTSecret:          []byte(env("GENESIS_JWT_SECRET")),
-		JWTExpiration:      time.Duration(parseInt(env("GENESIS_JWT_TOKEN_EXPIRATION"))) * time.Minute,
-		JWTCookieAllowHTTP: env("GENESIS_JWT_COOKIE_ALLOW_HTTP") == "true",
-		AppBuildVersion:    env("GENESIS_BUILD_VERSION"),
-		AppBuildDate:       env("GENESIS_BUILD_DATE"),
-		AppBuildCommit:     env("GENESIS_BUILD_COMMIT"),
-		AppGinMode:         env("GENESIS_GIN_MODE"),
-		AppPort:            env("GENESIS_PORT"),
-		AppUsersToCreate:   parseInitialUserList(env("GENESIS_CREATE_USERS")),
-		AppUserPattern:     regexp.MustCompile(env("GENESIS_USERNAME_PATTERN")),
-		AppKeyPattern:      regexp.MustCompile(env("GENESIS_KEY_PATTERN")),
-		AppDataMaxSize:     parseInt(env("GENESIS_DATA_MAX_SIZE")) * 1000,
-		AppKeysPerUser:     parseInt(env("GENESIS_KEYS_PER_USER")),
-		LoginMaxAttempts:   parseInt(env("GENESIS_LOGIN_MAX_ATTEMPTS")),
-		LoginLockDurations: parseDurations(env("GENESIS_LOGIN_LOCKOUT_DURATIONS")),
+		DbEncryptionKey:       []byte(env("GENESIS_DB_ENCRYPTION_KEY")),
+		BaseUrl:               env("GENESIS_BASE_URL"),
+		JWTSecret:             []byte(env("GENESIS_JWT_SECRET")),
+		JWTExpiration:         time.Duration(parseInt(env("GENESIS_JWT_TOKEN_EXPIRATION"))) * time.Minute,
+		JWTCookieAllowHTTP:    env("GENESIS_JWT_COOKIE_ALLOW_HTTP") == "true",
+		AppBuildVersion:       env("GENESIS_BUILD_VERSION"),
+		AppBuildDate:          env("GENESIS_BUILD_DATE"),
+		AppBuildCommit:        env("GENESIS_BUILD_COMMIT"),
+		AppGinMode:            env("GENESIS_GIN_MODE"),
+		AppPort:               env("GENESIS_PORT"),
+		AppUsersToCreate:      parseInitialUserList(env("GENESIS_CREATE_USERS")),
+		AppUserPattern:        regexp.MustCompile(env("GENESIS_USERNAME_PATTERN")),
+		AppKeyPattern:         regexp.MustCompile(env("GENESIS_KEY_PATTERN")),
+		AppDataMaxSize:        parseInt(env("GENESIS_DATA_MAX_SIZE")) * 1000,
+		AppKeysPerUser:        parseInt(env("GENESIS_KEYS_PER_USER")),
+		AppBatchMaxSize:       parseInt(envOr("GENESIS_BATCH_MAX_SIZE", "4_000")) * 1000,
+		AppQuotaPerUser:       parseInt(envOr("GENESIS_QUOTA_PER_USER", "0")) * 1000,
+		AppHistorySize:        parseInt(envOr("GENESIS_HISTORY_SIZE", "5")),
+		AppHistoryMaxSize:     parseInt(envOr("GENESIS_HISTORY_MAX_SIZE", "64_000")) * 1000,
+		AppEventsBufferSize:   parseInt(envOr("GENESIS_EVENTS_BUFFER_SIZE", "100")),
+		AppTombstoneRetention: time.Duration(parseInt(envOr("GENESIS_TOMBSTONE_RETENTION", "43_200"))) * time.Minute,
+		AppCompressionMinSize: parseInt(envOr("GENESIS_COMPRESSION_MIN_SIZE", "1024")),
+		AppTrashRetention:     time.Duration(parseInt(envOr("GENESIS_TRASH_RETENTION", "10_080"))) * time.Minute,
+		AppTrashMaxSize:       parseInt(envOr("GENESIS_TRASH_MAX_SIZE", "64_000")) * 1000,
+		AppCacheControl:       envOr("GENESIS_CACHE_CONTROL", "private, no-cache"),
+		AppIdempotencyTTL:     time.Duration(parseInt(envOr("GENESIS_IDEMPOTENCY_TTL", "1440"))) * time.Minute,
+		AppBackupInterval:     time.Duration(parseInt(envOr("GENESIS_BACKUP_INTERVAL", "0"))) * time.Minute,
+		AppBackupDir:          resolvePath(envOr("GENESIS_BACKUP_DIR", ".backups")),
+		AppBackupKeep:         parseInt(envOr("GENESIS_BACKUP_KEEP", "7")),
+		AppBackupPassphrase:   []byte(env("GENESIS_BACKUP_PASSPHRASE")),
+		LoginMaxAttempts:      parseInt(env("GENESIS_LOGIN_MAX_ATTEMPTS")),
+		LoginLockDurations:    parseDurations(env("GENESIS_LOGIN_LOCKOUT_DURATIONS")),
+		S3Endpoint:            env("GENESIS_S3_ENDPOINT"),
+		S3Region:              envOr("GENESIS_S3_REGION", "us-east-1"),
+		S3Bucket:              env("GENESIS_S3_BUCKET"),
+		S3Prefix:              env("GENESIS_S3_PREFIX"),
+		S3AccessKey:           env("GENESIS_S3_ACCESS_KEY"),
+		S3SecretKey:           env("GENESIS_S3_SECRET_KEY"),
+		S3PartSize:            parseInt(envOr("GENESIS_S3_PART_SIZE", "16")) << 20,
 	}
 
+	config.DbBackend, config.DbPath = parseStoreLocation(env("GENESIS_DB_PATH"))
+
 	Logger.Debug("build info",
 		zap.String("version", config.AppBuildVersion),
 		zap.String("date", config.AppBuildDate),
@@ -135,7 +183,21 @@ func env(key string) string {
 	return os.Getenv(key)
 }
 
+// envOr is like env but falls back to the given value for variables which
+// have been added later on and may be missing in existing .env files.
+func envOr(key, fallback string) string {
+	if v := env(key); v != "" {
+		return v
+	}
+
+	return fallback
+}
+
 func resolvePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
 	return filepath.Join(currentDir(), path)
 }
 
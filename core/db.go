@@ -5,13 +5,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/rand/v2"
 	"os"
 	"os/signal"
-	"strings"
+	"sync"
 	"syscall"
 	"time"
 
-	"github.com/dgraph-io/badger/v4"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -20,7 +20,39 @@ const (
 	dbKeySeparator       = "/"
 	dbUserPrefix         = "usr" // user:{name}
 	dbDataPrefix         = "dat"
+	dbMetaPrefix         = "met"
+	dbHistoryPrefix      = "his" // previous values
+	dbHistoryMetaPrefix  = "hmt" // metadata of previous values
+	dbHistoryIndexPrefix = "hix" // sizes of previous values by modification
+	dbHistorySizePrefix  = "hsz" // bytes of previous values of a user
+	dbUsagePrefix        = "use" // bytes stored by a user
+	dbExpirationPrefix   = "ttl" // sizes of expiring values
+	dbSequencePrefix     = "seq" // last change sequence of a user
+	dbTombstonePrefix    = "tmb" // sequence of deleted keys
+	dbSchemaPrefix       = "sch" // schemas by name
+	dbIdempotencyPrefix  = "idm" // responses by idempotency key
+	dbTrashPrefix        = "trs" // metadata of deleted values
+	dbTrashValuePrefix   = "trv" // deleted values
 	dbExpiredTokenPrefix = "exp" // data:{name}:{key}
+
+	// Amount of attempts for transactions conflicting with concurrent ones
+	// and the delay before the first retry, which doubles with every attempt
+	dbUpdateAttempts = 5
+	dbUpdateBackoff  = 2 * time.Millisecond
+
+	// Size of the cache for indices of encrypted tables
+	dbIndexCacheSize = 32 << 20 // 32MB
+)
+
+// userLock is the write lock of a user, it's removed once nobody holds or waits for it.
+type userLock struct {
+	sync.Mutex
+	waiting int
+}
+
+var (
+	userLocksMutex sync.Mutex
+	userLocks      = make(map[string]*userLock)
 )
 
 var (
@@ -51,7 +83,10 @@ type PublicUser struct {
 	Admin bool   `json:"admin"`
 }
 
-var database *badger.DB
+var (
+	database     Store
+	databaseOnce sync.Once
+)
 
 func CreateUser(user User) error {
 	key := buildUserKey(user.Name)
@@ -71,10 +106,10 @@ func CreateUser(user User) error {
 		return fmt.Errorf("failed to create user data: %w", err)
 	}
 
-	return database.Update(func(txn *badger.Txn) error {
+	return db().Update(func(txn Txn) error {
 		if _, err := txn.Get(key); err == nil {
 			return ErrUserAlreadyExists
-		} else if !errors.Is(err, badger.ErrKeyNotFound) {
+		} else if !errors.Is(err, ErrKeyNotFound) {
 			return fmt.Errorf("failed to check if user already exists: %w", err)
 		}
 
@@ -93,10 +128,10 @@ func UpdateUser(name string, user PartialUser) error {
 		user.Password = &hash
 	}
 
-	return database.Update(func(txn *badger.Txn) error {
+	return db().Update(func(txn Txn) error {
 		item, err := txn.Get(key)
 		if err != nil {
-			if errors.Is(err, badger.ErrKeyNotFound) {
+			if errors.Is(err, ErrKeyNotFound) {
 				return ErrUserNotFound
 			}
 			return fmt.Errorf("failed to check if user exists: %w", err)
@@ -147,13 +182,13 @@ func AuthenticateUser(name string, password string) (*User, error) {
 }
 
 func GetUser(name string) (*User, error) {
-	txn := database.NewTransaction(false)
+	txn := db().NewTransaction(false)
 	key := buildUserKey(name)
 	defer txn.Discard()
 
 	data, err := txn.Get(key)
 	if err != nil {
-		if errors.Is(err, badger.ErrKeyNotFound) {
+		if errors.Is(err, ErrKeyNotFound) {
 			return nil, nil
 		}
 
@@ -167,10 +202,10 @@ func GetUser(name string) (*User, error) {
 }
 
 func GetUsers(skip string) ([]*PublicUser, error) {
-	txn := database.NewTransaction(true)
+	txn := db().NewTransaction(true)
 	defer txn.Discard()
 
-	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	it := txn.NewIterator(DefaultIteratorOptions)
 	defer it.Close()
 
 	skipKey := buildUserKey(skip)
@@ -201,10 +236,10 @@ func GetUsers(skip string) ([]*PublicUser, error) {
 }
 
 func GetAllUsers() ([]*PublicUser, error) {
-	txn := database.NewTransaction(true)
+	txn := db().NewTransaction(true)
 	defer txn.Discard()
 
-	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	it := txn.NewIterator(DefaultIteratorOptions)
 	defer it.Close()
 
 	users := make([]*PublicUser, 0)
@@ -229,69 +264,173 @@ func GetAllUsers() ([]*PublicUser, error) {
 }
 
 func DeleteUser(name string) error {
-	txn := database.NewTransaction(true)
-	defer txn.Discard()
+	unlock := lockUser(name)
+	defer unlock()
 
-	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	txn := db().NewTransaction(true)
+	defer txn.Discard()
 
-	// Remove data
-	prefix := buildUserDataKey(name, "")
-	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
-		if err := txn.Delete(it.Item().Key()); err != nil {
-			it.Close()
+	// Remove data, metadata, previous versions, tombstones, stored responses and the trash
+	for _, prefix := range [][]byte{
+		buildUserDataKey(name, ""),
+		buildUserMetaKey(name, ""),
+		buildHistoryPrefix(dbHistoryPrefix, name, ""),
+		buildHistoryPrefix(dbHistoryMetaPrefix, name, ""),
+		buildHistoryIndexPrefix(name),
+		buildExpirationPrefix(name),
+		buildTombstoneKey(name, ""),
+		buildIdempotencyKey(name, ""),
+		buildTrashKey(dbTrashPrefix, name, ""),
+		buildTrashKey(dbTrashValuePrefix, name, ""),
+	} {
+		if err := deletePrefix(txn, prefix); err != nil {
 			return err
 		}
 	}
 
-	it.Close()
-
-	// Remove user
+	// Remove user, its usage, change sequence and the size of its history
 	if err := txn.Delete(buildUserKey(name)); err != nil {
 		return err
+	} else if err := txn.Delete(buildUsageKey(name)); err != nil {
+		return err
+	} else if err := txn.Delete(buildSequenceKey(name)); err != nil {
+		return err
+	} else if err := txn.Delete(buildHistorySizeKey(name)); err != nil {
+		return err
+	} else if err := txn.Commit(); err != nil {
+		return err
 	}
 
-	return txn.Commit()
+	closeEventStream(name)
+	return nil
 }
 
-func SetDataForUser(name string, key string, data []byte) error {
-	txn := database.NewTransaction(true)
-	defer txn.Discard()
+func SetDataForUser(name string, key string, data []byte, opts WriteOptions) (*DataMeta, error) {
+	unlock := lockUser(name)
+	defer unlock()
+
+	var meta *DataMeta
 
-	if err := txn.Set(buildUserDataKey(name, key), data); err != nil {
+	err := update(func(txn Txn) (err error) {
+		meta, err = setData(txn, name, key, data, opts)
 		return err
+	})
+
+	if err == nil {
+		publishSet(name, key, meta, data)
 	}
 
-	return txn.Commit()
+	return meta, err
 }
 
-func DeleteDataFromUser(name string, key string) error {
-	txn := database.NewTransaction(true)
-	defer txn.Discard()
+// UpdateDataForUser atomically replaces the value of an existing key with the result of fn,
+// ErrKeyNotFound is returned if there is no such key.
+func UpdateDataForUser(name string, key string, fn func(current []byte) ([]byte, error), opts WriteOptions) (*DataMeta, error) {
+	unlock := lockUser(name)
+	defer unlock()
+
+	var meta *DataMeta
+	var data []byte
+
+	err := update(func(txn Txn) (err error) {
+		meta, data, err = updateData(txn, name, key, fn, opts)
+		return err
+	})
+
+	if err == nil {
+		publishSet(name, key, meta, data)
+	}
+
+	return meta, err
+}
+
+// RenameDataForUser atomically moves the value of key to target, see CopyDataForUser.
+func RenameDataForUser(name, key, target string, overwrite bool, opts WriteOptions) (*DataMeta, error) {
+	unlock := lockUser(name)
+	defer unlock()
 
-	if err := txn.Delete(buildUserDataKey(name, key)); err != nil {
+	var meta, removed *DataMeta
+	var data []byte
+
+	err := update(func(txn Txn) (err error) {
+		if removed, err = getMeta(txn, name, key); err != nil {
+			return err
+		}
+
+		meta, data, err = copyData(txn, name, key, target, overwrite, true, opts)
+		return err
+	})
+
+	if err == nil {
+		publishDelete(name, key, removed)
+		publishSet(name, target, meta, data)
+	}
+
+	return meta, err
+}
+
+// CopyDataForUser atomically stores the value of key as target. ErrKeyNotFound is returned if there
+// is no such key and ErrKeyExists if target exists and overwrite isn't set.
+func CopyDataForUser(name, key, target string, overwrite bool, opts WriteOptions) (*DataMeta, error) {
+	unlock := lockUser(name)
+	defer unlock()
+
+	var meta *DataMeta
+	var data []byte
+
+	err := update(func(txn Txn) (err error) {
+		meta, data, err = copyData(txn, name, key, target, overwrite, false, opts)
+		return err
+	})
+
+	if err == nil {
+		publishSet(name, target, meta, data)
+	}
+
+	return meta, err
+}
+
+func DeleteDataFromUser(name string, key string, opts WriteOptions) error {
+	unlock := lockUser(name)
+	defer unlock()
+
+	var meta *DataMeta
+
+	err := update(func(txn Txn) (err error) {
+		meta, err = deleteData(txn, name, key, opts)
 		return err
+	})
+
+	if err == nil {
+		publishDelete(name, key, meta)
 	}
 
-	return txn.Commit()
+	return err
 }
 
-func GetDataFromUser(name string, key string) ([]byte, error) {
-	txn := database.NewTransaction(false)
+func GetDataFromUser(name string, key string) ([]byte, *DataMeta, error) {
+	txn := db().NewTransaction(false)
 	defer txn.Discard()
 
 	item, err := txn.Get(buildUserDataKey(name, key))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+
+	meta, err := getMeta(txn, name, key)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	return item.ValueCopy(nil)
+	data, err := readValue(item)
+	return data, meta, err
 }
 
 func GetAllDataFromUser(name string) ([]byte, error) {
-	txn := database.NewTransaction(false)
+	txn := db().NewTransaction(false)
 	defer txn.Discard()
 
-	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	it := txn.NewIterator(DefaultIteratorOptions)
 	defer it.Close()
 
 	prefix := buildUserDataKey(name, "")
@@ -301,7 +440,7 @@ func GetAllDataFromUser(name string) ([]byte, error) {
 		item := it.Item()
 		k := string(item.Key()[len(prefix):])
 
-		v, err := item.ValueCopy(nil)
+		v, err := readValue(item)
 		if err != nil {
 			return nil, err
 		}
@@ -316,10 +455,10 @@ func GetAllDataFromUser(name string) ([]byte, error) {
 }
 
 func GetDataCountForUser(name, includedKey string) int64 {
-	txn := database.NewTransaction(false)
+	txn := db().NewTransaction(false)
 	defer txn.Discard()
 
-	it := txn.NewIterator(badger.DefaultIteratorOptions)
+	it := txn.NewIterator(DefaultIteratorOptions)
 	defer it.Close()
 
 	prefix := buildUserDataKey(name, "")
@@ -343,18 +482,18 @@ func GetDataCountForUser(name, includedKey string) int64 {
 }
 
 func StoreInvalidatedToken(jti string, expiration time.Duration) error {
-	return database.Update(func(txn *badger.Txn) error {
-		return txn.SetEntry(badger.NewEntry(buildExpiredKey(jti), []byte{}).WithTTL(expiration))
+	return db().Update(func(txn Txn) error {
+		return txn.SetEntry(buildExpiredKey(jti), []byte{}, time.Now().Add(expiration))
 	})
 }
 
 func IsTokenBlacklisted(jti string) (bool, error) {
-	txn := database.NewTransaction(false)
+	txn := db().NewTransaction(false)
 	defer txn.Discard()
 
 	item, err := txn.Get(buildExpiredKey(jti))
 
-	if errors.Is(err, badger.ErrKeyNotFound) {
+	if errors.Is(err, ErrKeyNotFound) {
 		return false, nil
 	}
 
@@ -362,7 +501,7 @@ func IsTokenBlacklisted(jti string) (bool, error) {
 }
 
 func ResetDatabase() {
-	if err := database.DropAll(); err != nil {
+	if err := db().DropAll(); err != nil {
 		Logger.Fatal("failed to drop database", zap.Error(err))
 	}
 
@@ -387,25 +526,15 @@ func InitializeUsers() {
 }
 
 func printDebugInformation() {
-	txn := database.NewTransaction(false)
-	defer txn.Discard()
-
-	it := txn.NewIterator(badger.DefaultIteratorOptions)
-	defer it.Close()
-
-	results := make(map[string]int)
-	results[dbUserPrefix] = 0
-	results[dbDataPrefix] = 0
-	results[dbExpiredTokenPrefix] = 0
-
-	for it.Rewind(); it.Valid(); it.Next() {
-		key := strings.Split(string(it.Item().Key()), dbKeySeparator)
-		results[key[0]]++
+	counts, err := countPrefixes(database)
+	if err != nil {
+		Logger.Error("failed to count keys", zap.Error(err))
+		return
 	}
 
-	Logger.Debug("users", zap.Int("count", results[dbUserPrefix]))
-	Logger.Debug("datasets", zap.Int("count", results[dbDataPrefix]))
-	Logger.Debug("expired keys", zap.Int("count", results[dbExpiredTokenPrefix]))
+	Logger.Debug("users", zap.Int("count", counts[dbUserPrefix]))
+	Logger.Debug("datasets", zap.Int("count", counts[dbDataPrefix]))
+	Logger.Debug("expired keys", zap.Int("count", counts[dbExpiredTokenPrefix]))
 }
 
 func buildExpiredKey(key string) []byte {
@@ -420,6 +549,99 @@ func buildUserDataKey(name, key string) []byte {
 	return []byte(dbDataPrefix + dbKeySeparator + name + dbKeySeparator + key)
 }
 
+func buildUserMetaKey(name, key string) []byte {
+	return []byte(dbMetaPrefix + dbKeySeparator + name + dbKeySeparator + key)
+}
+
+func buildUsageKey(name string) []byte {
+	return []byte(dbUsagePrefix + dbKeySeparator + name)
+}
+
+func buildHistoryKey(prefix, name, key string, revision uint64) []byte {
+	return append(buildHistoryPrefix(prefix, name, key), fmt.Sprintf("%020d", revision)...)
+}
+
+// buildHistoryPrefix returns the prefix of all previous versions of key, or of all keys if it's empty.
+func buildHistoryPrefix(prefix, name, key string) []byte {
+	if key == "" {
+		return []byte(prefix + dbKeySeparator + name + dbKeySeparator)
+	}
+
+	return []byte(prefix + dbKeySeparator + name + dbKeySeparator + key + dbKeySeparator)
+}
+
+// lockUser serializes the writes of a user, all of them change its usage and change sequence
+// and would conflict with each other otherwise. Their events are published before it's released
+// to reach subscribers in the order of the writes. The returned function releases the lock.
+func lockUser(name string) func() {
+	userLocksMutex.Lock()
+	lock := userLocks[name]
+	if lock == nil {
+		lock = &userLock{}
+		userLocks[name] = lock
+	}
+
+	lock.waiting++
+	userLocksMutex.Unlock()
+	lock.Lock()
+
+	return func() {
+		lock.Unlock()
+		userLocksMutex.Lock()
+
+		if lock.waiting--; lock.waiting == 0 {
+			delete(userLocks, name)
+		}
+
+		userLocksMutex.Unlock()
+	}
+}
+
+// updateUser is like update but holds the lock of the user while doing so.
+func updateUser(name string, fn func(txn Txn) error) error {
+	unlock := lockUser(name)
+	defer unlock()
+
+	return update(fn)
+}
+
+// update runs fn in a read-write transaction and retries it if it conflicted with a concurrent one.
+// ErrConflict is returned if all attempts conflicted.
+func update(fn func(txn Txn) error) error {
+	var err error
+
+	for i := 0; i < dbUpdateAttempts; i++ {
+
+		// Randomized to not retry in lockstep with the transactions it conflicted with
+		if i > 0 {
+			delay := dbUpdateBackoff << (i - 1)
+			time.Sleep(delay/2 + rand.N(delay/2))
+		}
+
+		if err = db().Update(fn); !errors.Is(err, ErrConflict) {
+			return err
+		}
+	}
+
+	return err
+}
+
+func deletePrefix(txn Txn, prefix []byte) error {
+	opts := DefaultIteratorOptions
+	opts.PrefetchValues = false
+
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		if err := txn.Delete(it.Item().KeyCopy(nil)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func hashPassword(pwd string) (string, error) {
 	hashed, err := bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.DefaultCost)
 
@@ -430,21 +652,50 @@ func hashPassword(pwd string) (string, error) {
 	return string(hashed), err
 }
 
+// db returns the database, it's opened on first use to allow maintenance commands to work on a closed one.
+func db() Store {
+	databaseOnce.Do(func() {
+		if opened, err := openStore(Config.DbBackend, Config.DbPath, Config.DbEncryptionKey); err != nil {
+			Logger.Fatal("failed to open database", zap.Error(err))
+		} else {
+			database = opened
+		}
+
+		// Purge expired values from the trash
+		go func() {
+			ticker := time.NewTicker(trashPurgeInterval)
+			defer ticker.Stop()
+
+			for {
+				<-ticker.C
+				if err := purgeTrash(); err != nil {
+					Logger.Error("failed to purge trash", zap.Error(err))
+				}
+			}
+		}()
+
+		// Write backups to the backup directory
+		if Config.AppBackupInterval > 0 {
+			go func() {
+				ticker := time.NewTicker(Config.AppBackupInterval)
+				defer ticker.Stop()
+
+				for {
+					<-ticker.C
+					if err := RunScheduledBackup(); err != nil {
+						Logger.Error("failed to write backup", zap.Error(err))
+					}
+				}
+			}()
+		}
+
+		printDebugInformation()
+	})
+
+	return database
+}
+
 func init() {
-	options := badger.DefaultOptions(Config.DbPath)
-	options.Logger = nil
-
-	// Adjust options for a smaller database
-	options.CompactL0OnClose = true
-	options.ValueLogFileSize = 64 << 20 // 64MB
-	options.NumLevelZeroTables = 1
-	options.NumLevelZeroTablesStall = 2
-
-	if db, err := badger.Open(options); err != nil {
-		Logger.Fatal("failed to open database", zap.Error(err))
-	} else {
-		database = db
-	}
 
 	// Shutdown database gracefully
 	sigs := make(chan os.Signal, 1)
@@ -452,30 +703,18 @@ func init() {
 
 	go func() {
 		sig := <-sigs
-		Logger.Info("received signal, closing database", zap.String("signal", sig.String()))
 
-		if err := database.Close(); err != nil {
-			Logger.Error("failed to close database", zap.Error(err))
-		}
+		// Prevents the database from being opened from now on
+		databaseOnce.Do(func() {})
 
-		os.Exit(0)
-	}()
+		if database != nil {
+			Logger.Info("received signal, closing database", zap.String("signal", sig.String()))
 
-	// Run garbage collector once an hour
-	go func() {
-		ticker := time.NewTicker(1 * time.Hour)
-		defer ticker.Stop()
-
-		for {
-			<-ticker.C
-			err := database.RunValueLogGC(0.5)
-			if errors.Is(err, badger.ErrNoRewrite) {
-				continue
-			} else if err != nil {
-				Logger.Error("failed to run value log GC", zap.Error(err))
+			if err := database.Close(); err != nil {
+				Logger.Error("failed to close database", zap.Error(err))
 			}
 		}
-	}()
 
-	printDebugInformation()
+		os.Exit(0)
+	}()
 }
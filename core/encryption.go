@@ -0,0 +1,109 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dgraph-io/badger/v4"
+)
+
+// Badger encrypts all data with data keys which are rotated periodically, those are stored
+// in a key registry encrypted with the configured key.
+
+var (
+	ErrNoEncryptionKey       = errors.New("no encryption key configured, set GENESIS_DB_ENCRYPTION_KEY")
+	ErrInvalidEncryptionKey  = errors.New("encryption key must be 16, 24 or 32 bytes long")
+	ErrEncryptionUnsupported = errors.New("encryption is only supported by the badger backend")
+)
+
+// RotateEncryptionKey re-encrypts the key registry with newKey, the database must not be in use.
+func RotateEncryptionKey(newKey []byte) error {
+	if Config.DbBackend != dbBackendBadger {
+		return ErrEncryptionUnsupported
+	} else if len(Config.DbEncryptionKey) == 0 {
+		return ErrNoEncryptionKey
+	} else if !validEncryptionKey(newKey) {
+		return ErrInvalidEncryptionKey
+	}
+
+	// Opening it verifies the current key and that no one else is using it
+	if current, err := openBadger(Config.DbPath, Config.DbEncryptionKey); err != nil {
+		return err
+	} else if err := current.Close(); err != nil {
+		return err
+	}
+
+	options := badger.KeyRegistryOptions{
+		Dir:                           Config.DbPath,
+		ReadOnly:                      true,
+		EncryptionKey:                 Config.DbEncryptionKey,
+		EncryptionKeyRotationDuration: badger.DefaultOptions("").EncryptionKeyRotationDuration,
+	}
+
+	registry, err := badger.OpenKeyRegistry(options)
+	if err != nil {
+		return err
+	}
+	defer registry.Close()
+
+	options.EncryptionKey = newKey
+	return badger.WriteKeyRegistry(registry, options)
+}
+
+// EncryptDatabase copies a plaintext database into a new one encrypted with the configured key
+// and puts it in its place. The path the plaintext database has been moved to is returned.
+func EncryptDatabase() (string, error) {
+	encryptedPath := Config.DbPath + ".encrypted"
+	plainPath := Config.DbPath + ".plain"
+
+	if Config.DbBackend != dbBackendBadger {
+		return "", ErrEncryptionUnsupported
+	} else if len(Config.DbEncryptionKey) == 0 {
+		return "", ErrNoEncryptionKey
+	} else if !validEncryptionKey(Config.DbEncryptionKey) {
+		return "", ErrInvalidEncryptionKey
+	}
+
+	for _, path := range []string{encryptedPath, plainPath} {
+		if _, err := os.Stat(path); err == nil {
+			return "", fmt.Errorf("%s already exists", path)
+		}
+	}
+
+	plain, err := openBadger(Config.DbPath, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to open plaintext database: %w", err)
+	}
+	defer plain.Close()
+
+	encrypted, err := openBadger(encryptedPath, Config.DbEncryptionKey)
+	if err != nil {
+		return "", err
+	}
+	defer encrypted.Close()
+
+	reader, writer := io.Pipe()
+	go func() {
+		_, err := plain.Backup(writer, 0)
+		writer.CloseWithError(err)
+	}()
+
+	if err := encrypted.Load(reader, 256); err != nil {
+		reader.CloseWithError(err)
+		return "", err
+	} else if err := encrypted.Close(); err != nil {
+		return "", err
+	} else if err := plain.Close(); err != nil {
+		return "", err
+	} else if err := os.Rename(Config.DbPath, plainPath); err != nil {
+		return "", err
+	}
+
+	return plainPath, os.Rename(encryptedPath, Config.DbPath)
+}
+
+func validEncryptionKey(key []byte) bool {
+	return len(key) == 16 || len(key) == 24 || len(key) == 32
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func readTestValue(t *testing.T, path string, key []byte) string {
+	store, err := openStore(dbBackendBadger, path, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	var value []byte
+	assert.NoError(t, store.View(func(txn Txn) error {
+		item, err := txn.Get(buildUserDataKey("foo", "a"))
+		if err != nil {
+			return err
+		}
+
+		value, err = item.ValueCopy(nil)
+		return err
+	}))
+
+	return string(value)
+}
+
+func TestEncryptDatabase(t *testing.T) {
+	config := Config
+	t.Cleanup(func() { Config = config })
+
+	oldKey := []byte("0123456789abcdef")
+	newKey := []byte("fedcba9876543210fedcba9876543210")
+	Config.DbBackend = dbBackendBadger
+	Config.DbPath = filepath.Join(t.TempDir(), "db")
+	Config.DbEncryptionKey = nil
+
+	store, err := openStore(dbBackendBadger, Config.DbPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, store.Update(func(txn Txn) error {
+		return txn.Set(buildUserDataKey("foo", "a"), []byte("1"))
+	}))
+	assert.NoError(t, store.Close())
+
+	_, err = EncryptDatabase()
+	assert.ErrorIs(t, err, ErrNoEncryptionKey)
+	assert.ErrorIs(t, RotateEncryptionKey(newKey), ErrNoEncryptionKey)
+
+	// The plaintext database is kept next to the encrypted one
+	Config.DbEncryptionKey = oldKey
+	plainPath, err := EncryptDatabase()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, "1", readTestValue(t, plainPath, nil))
+	assert.Equal(t, "1", readTestValue(t, Config.DbPath, oldKey))
+
+	_, err = openStore(dbBackendBadger, Config.DbPath, nil)
+	assert.Error(t, err)
+
+	_, err = EncryptDatabase()
+	assert.ErrorContains(t, err, "already exists")
+
+	// Only the new key opens the database after rotating it
+	assert.ErrorIs(t, RotateEncryptionKey([]byte("short")), ErrInvalidEncryptionKey)
+	assert.NoError(t, RotateEncryptionKey(newKey))
+	assert.Equal(t, "1", readTestValue(t, Config.DbPath, newKey))
+
+	_, err = openStore(dbBackendBadger, Config.DbPath, oldKey)
+	assert.ErrorIs(t, err, badger.ErrEncryptionKeyMismatch)
+
+	Config.DbEncryptionKey = newKey
+	Config.DbBackend = dbBackendBolt
+	assert.ErrorIs(t, RotateEncryptionKey(oldKey), ErrEncryptionUnsupported)
+}
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	EventSet    = "set"
+	EventDelete = "delete"
+
+	eventSubscriberBuffer = 64
+
+	// Streams are kept for a while after their last subscriber left so that reconnecting clients can resume
+	eventStreamRetention = time.Minute
+)
+
+var ErrEventsLost = errors.New("events since the given id are no longer available")
+
+var (
+	eventsMutex  sync.Mutex
+	eventStreams = make(map[string]*eventStream)
+
+	// Event ids start at the time the process started, ids of a previous run are always lower
+	lastEventID = uint64(time.Now().UnixMicro())
+)
+
+// DataEvent describes a committed change to a value of a user.
+type DataEvent struct {
+	ID        uint64          `json:"-"`
+	Operation string          `json:"operation"`
+	Key       string          `json:"key"`
+	Revision  uint64          `json:"revision"`
+	Value     json.RawMessage `json:"value,omitempty"` // Only set for EventSet
+}
+
+// eventStream buffers the events of a user while there are subscribers, and for a while after the last one left.
+type eventStream struct {
+	events      []DataEvent // Most recent events, oldest first
+	dropped     uint64      // ID of the last event which is no longer buffered
+	subscribers map[chan DataEvent]struct{}
+	idle        *time.Timer // Removes the stream once it's been without subscribers for too long
+}
+
+// SubscribeEvents returns a channel receiving all future events of a user. If lastID is non-zero,
+// buffered events after it are returned as well, or ErrEventsLost if some of them are gone.
+// The channel is closed once cancel is called or if the subscriber can't keep up.
+func SubscribeEvents(name string, lastID uint64) (<-chan DataEvent, []DataEvent, func(), error) {
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+
+	stream := getEventStream(name)
+	channel := make(chan DataEvent, eventSubscriberBuffer)
+	stream.subscribers[channel] = struct{}{}
+
+	if stream.idle != nil {
+		stream.idle.Stop()
+		stream.idle = nil
+	}
+
+	cancel := func() {
+		eventsMutex.Lock()
+		defer eventsMutex.Unlock()
+		removeSubscriber(name, stream, channel)
+	}
+
+	if lastID == 0 {
+		return channel, nil, cancel, nil
+	} else if lastID < stream.dropped {
+		return channel, nil, cancel, ErrEventsLost
+	}
+
+	var missed []DataEvent
+	for _, event := range stream.events {
+		if event.ID > lastID {
+			missed = append(missed, event)
+		}
+	}
+
+	return channel, missed, cancel, nil
+}
+
+func publishSet(name, key string, meta *DataMeta, data []byte) {
+	publishEvent(name, DataEvent{Operation: EventSet, Key: key, Revision: meta.Revision, Value: data})
+}
+
+func publishDelete(name, key string, meta *DataMeta) {
+	if meta != nil {
+		publishEvent(name, DataEvent{Operation: EventDelete, Key: key, Revision: meta.Revision})
+	}
+}
+
+func publishEvent(name string, event DataEvent) {
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+
+	lastEventID++
+	event.ID = lastEventID
+
+	// Nobody is interested in the events of this user
+	stream := eventStreams[name]
+	if stream == nil {
+		return
+	}
+
+	stream.events = append(stream.events, event)
+
+	if overflow := int64(len(stream.events)) - Config.AppEventsBufferSize; overflow > 0 {
+		stream.dropped = stream.events[overflow-1].ID
+		stream.events = append([]DataEvent(nil), stream.events[overflow:]...)
+	}
+
+	for channel := range stream.subscribers {
+		select {
+		case channel <- event:
+		default:
+
+			// Slow subscribers have to reconnect and resume from their last event
+			removeSubscriber(name, stream, channel)
+		}
+	}
+}
+
+// closeEventStream disconnects all subscribers of a user and drops its buffered events.
+func closeEventStream(name string) {
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+
+	if stream := eventStreams[name]; stream != nil {
+		for channel := range stream.subscribers {
+			removeSubscriber(name, stream, channel)
+		}
+
+		if stream.idle != nil {
+			stream.idle.Stop()
+		}
+
+		delete(eventStreams, name)
+	}
+}
+
+// getEventStream returns the stream of a user, new ones don't have the events published before.
+func getEventStream(name string) *eventStream {
+	stream := eventStreams[name]
+
+	if stream == nil {
+		stream = &eventStream{
+			dropped:     lastEventID,
+			subscribers: make(map[chan DataEvent]struct{}),
+		}
+
+		eventStreams[name] = stream
+	}
+
+	return stream
+}
+
+// removeSubscriber closes the channel of a subscriber, the stream is removed once it's been left
+// without subscribers for the retention period. The events mutex must be held.
+func removeSubscriber(name string, stream *eventStream, channel chan DataEvent) {
+	if _, ok := stream.subscribers[channel]; !ok {
+		return
+	}
+
+	delete(stream.subscribers, channel)
+	close(channel)
+
+	if len(stream.subscribers) == 0 && stream.idle == nil {
+		stream.idle = time.AfterFunc(eventStreamRetention, func() {
+			eventsMutex.Lock()
+			defer eventsMutex.Unlock()
+
+			if eventStreams[name] == stream && len(stream.subscribers) == 0 {
+				delete(eventStreams, name)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func hasEventStream(name string) bool {
+	eventsMutex.Lock()
+	defer eventsMutex.Unlock()
+	return eventStreams[name] != nil
+}
+
+func TestEventStreams(t *testing.T) {
+	name := "events"
+	meta := &DataMeta{Revision: 1}
+	t.Cleanup(func() { closeEventStream(name) })
+
+	// Events aren't buffered while nobody is subscribed
+	publishSet(name, "a", meta, []byte("1"))
+	assert.False(t, hasEventStream(name))
+
+	events, missed, cancel, err := SubscribeEvents(name, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, missed)
+
+	publishSet(name, "b", meta, []byte("2"))
+	received := <-events
+	assert.Equal(t, "b", received.Key)
+
+	// Streams are kept for reconnecting subscribers for a while
+	cancel()
+	publishSet(name, "c", meta, []byte("3"))
+	assert.True(t, hasEventStream(name))
+
+	_, missed, cancel, err = SubscribeEvents(name, received.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, missed, 1) {
+		assert.Equal(t, "c", missed[0].Key)
+	}
+
+	cancel()
+
+	eventsMutex.Lock()
+	eventStreams[name].idle.Reset(0)
+	eventsMutex.Unlock()
+
+	assert.Eventually(t, func() bool { return !hasEventStream(name) }, time.Second, 10*time.Millisecond)
+
+	// Events published while there was no stream are gone
+	_, _, cancel, err = SubscribeEvents(name, received.ID)
+	assert.ErrorIs(t, err, ErrEventsLost)
+	cancel()
+}
+
+func TestEventStreamsOfDeletedUsers(t *testing.T) {
+	useTestStore(t, dbBackendMemory)
+	name := "deleted"
+
+	events, _, cancel, err := SubscribeEvents(name, 0)
+	assert.NoError(t, err)
+	defer cancel()
+
+	assert.NoError(t, DeleteUser(name))
+	assert.False(t, hasEventStream(name))
+
+	_, ok := <-events
+	assert.False(t, ok)
+}
+
+func TestEventOrder(t *testing.T) {
+	useTestStore(t, dbBackendBadger)
+	name := "ordered"
+	t.Cleanup(func() { closeEventStream(name) })
+
+	events, _, cancel, err := SubscribeEvents(name, 0)
+	assert.NoError(t, err)
+	defer cancel()
+
+	// Concurrent writes to the same key are published in the order of their revisions
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := SetDataForUser(name, "a", []byte(strconv.Itoa(i)), WriteOptions{})
+			assert.NoError(t, err)
+		}()
+	}
+
+	wg.Wait()
+
+	revision := uint64(0)
+	for i := 0; i < 20; i++ {
+		event := <-events
+		assert.Greater(t, event.Revision, revision)
+		revision = event.Revision
+	}
+}
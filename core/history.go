@@ -0,0 +1,299 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type historyEntry struct {
+	key  string
+	meta DataMeta
+}
+
+// GetDataHistory returns the metadata of all previous versions of key, newest first.
+func GetDataHistory(name, key string) ([]*DataMeta, error) {
+	txn := db().NewTransaction(false)
+	defer txn.Discard()
+
+	entries, err := listHistory(txn, name, key)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]*DataMeta, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		list = append(list, &entries[i].meta)
+	}
+
+	return list, nil
+}
+
+func GetDataVersion(name, key string, revision uint64) ([]byte, *DataMeta, error) {
+	txn := db().NewTransaction(false)
+	defer txn.Discard()
+
+	return getVersion(txn, name, key, revision)
+}
+
+// RestoreDataVersion stores a previous version of key as its new value.
+func RestoreDataVersion(name, key string, revision uint64, opts WriteOptions) (*DataMeta, error) {
+	unlock := lockUser(name)
+	defer unlock()
+
+	var meta *DataMeta
+	var data []byte
+
+	err := update(func(txn Txn) (err error) {
+		if data, _, err = getVersion(txn, name, key, revision); err != nil {
+			return err
+		}
+
+		opts.KeepExpiration = true
+		meta, err = setData(txn, name, key, data, opts)
+		return err
+	})
+
+	if err == nil {
+		publishSet(name, key, meta, data)
+	}
+
+	return meta, err
+}
+
+func getVersion(txn Txn, name, key string, revision uint64) ([]byte, *DataMeta, error) {
+	metaItem, err := txn.Get(buildHistoryKey(dbHistoryMetaPrefix, name, key, revision))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var meta DataMeta
+	if err := metaItem.Value(func(val []byte) error {
+		return json.Unmarshal(val, &meta)
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	item, err := txn.Get(buildHistoryKey(dbHistoryPrefix, name, key, revision))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := readValue(item)
+	return data, &meta, err
+}
+
+// pushHistory moves the currently stored value of key into its history.
+func pushHistory(txn Txn, name, key string, current *DataMeta) error {
+	if Config.AppHistorySize <= 0 {
+		return nil
+	}
+
+	item, err := txn.Get(buildUserDataKey(name, key))
+	if err != nil {
+		return err
+	}
+
+	// The value is moved as it is stored, including its encoding
+	data, err := item.ValueCopy(nil)
+	if err != nil {
+		return err
+	}
+
+	meta := *current
+
+	encoded, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	if err := adjustHistorySize(txn, name, meta.Size); err != nil {
+		return err
+	} else if err := txn.Set(buildHistoryKey(dbHistoryPrefix, name, key, meta.Revision), data); err != nil {
+		return err
+	} else if err := txn.Set(buildHistoryKey(dbHistoryMetaPrefix, name, key, meta.Revision), encoded); err != nil {
+		return err
+	} else if err := addHistoryIndex(txn, name, historyEntry{key: key, meta: meta}); err != nil {
+		return err
+	}
+
+	return trimHistory(txn, name, key)
+}
+
+// trimHistory drops the oldest versions of key exceeding the configured amount,
+// afterward the oldest versions of all keys until the users' history fits into its size budget.
+func trimHistory(txn Txn, name, key string) error {
+	entries, err := listHistory(txn, name, key)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < len(entries)-int(Config.AppHistorySize); i++ {
+		if err := deleteVersion(txn, name, entries[i]); err != nil {
+			return err
+		}
+	}
+
+	size, err := getHistorySize(txn, name)
+	if err != nil || size <= Config.AppHistoryMaxSize {
+		return err
+	}
+
+	// The index is ordered by modification, only the versions which are removed are visited
+	it := txn.NewIterator(DefaultIteratorOptions)
+	defer it.Close()
+
+	prefix := buildHistoryIndexPrefix(name)
+	for it.Seek(prefix); it.ValidForPrefix(prefix) && size > Config.AppHistoryMaxSize; it.Next() {
+		entry, err := parseHistoryIndex(it.Item(), len(prefix))
+		if err != nil {
+			return err
+		} else if err := deleteVersion(txn, name, entry); err != nil {
+			return err
+		}
+
+		size -= entry.meta.Size
+	}
+
+	return nil
+}
+
+func deleteHistory(txn Txn, name, key string) error {
+	entries, err := listHistory(txn, name, key)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := deleteVersion(txn, name, entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func deleteVersion(txn Txn, name string, entry historyEntry) error {
+	if err := adjustHistorySize(txn, name, -entry.meta.Size); err != nil {
+		return err
+	} else if err := txn.Delete(buildHistoryKey(dbHistoryPrefix, name, entry.key, entry.meta.Revision)); err != nil {
+		return err
+	} else if err := txn.Delete(buildHistoryIndexKey(name, entry)); err != nil {
+		return err
+	}
+
+	return txn.Delete(buildHistoryKey(dbHistoryMetaPrefix, name, entry.key, entry.meta.Revision))
+}
+
+// adjustHistorySize adds delta to the bytes of all previous versions of a user,
+// it must be called before a version is added or removed.
+func adjustHistorySize(txn Txn, name string, delta int64) error {
+	size, err := getHistorySize(txn, name)
+	if err != nil {
+		return err
+	}
+
+	return txn.Set(buildHistorySizeKey(name), []byte(strconv.FormatInt(size+delta, 10)))
+}
+
+// getHistorySize returns the bytes of all previous versions of a user, the size and the index
+// ordered by modification are built once for versions stored before they were tracked.
+func getHistorySize(txn Txn, name string) (int64, error) {
+	item, err := txn.Get(buildHistorySizeKey(name))
+
+	if errors.Is(err, ErrKeyNotFound) {
+		entries, err := listHistory(txn, name, "")
+		if err != nil {
+			return 0, err
+		}
+
+		size := int64(0)
+		for _, entry := range entries {
+			if err := addHistoryIndex(txn, name, entry); err != nil {
+				return 0, err
+			}
+
+			size += entry.meta.Size
+		}
+
+		return size, txn.Set(buildHistorySizeKey(name), []byte(strconv.FormatInt(size, 10)))
+	} else if err != nil {
+		return 0, err
+	}
+
+	var size int64
+	err = item.Value(func(val []byte) (err error) {
+		size, err = strconv.ParseInt(string(val), 10, 64)
+		return err
+	})
+
+	return size, err
+}
+
+func addHistoryIndex(txn Txn, name string, entry historyEntry) error {
+	return txn.Set(buildHistoryIndexKey(name, entry), []byte(strconv.FormatInt(entry.meta.Size, 10)))
+}
+
+func parseHistoryIndex(item Item, prefixLength int) (historyEntry, error) {
+	path := string(item.Key()[prefixLength:])
+	entry := historyEntry{key: path[42:]}
+
+	modified, err := strconv.ParseInt(path[:20], 10, 64)
+	if err != nil {
+		return entry, err
+	} else if entry.meta.Revision, err = strconv.ParseUint(path[21:41], 10, 64); err != nil {
+		return entry, err
+	}
+
+	entry.meta.Modified = time.UnixMicro(modified)
+	err = item.Value(func(val []byte) (err error) {
+		entry.meta.Size, err = strconv.ParseInt(string(val), 10, 64)
+		return err
+	})
+
+	return entry, err
+}
+
+// buildHistoryIndexKey orders versions by their modification, versions stored before it was tracked come first.
+func buildHistoryIndexKey(name string, entry historyEntry) []byte {
+	modified := max(entry.meta.Modified.UnixMicro(), 0)
+	return append(buildHistoryIndexPrefix(name), fmt.Sprintf("%020d%s%020d%s%s", modified, dbKeySeparator, entry.meta.Revision, dbKeySeparator, entry.key)...)
+}
+
+func buildHistoryIndexPrefix(name string) []byte {
+	return []byte(dbHistoryIndexPrefix + dbKeySeparator + name + dbKeySeparator)
+}
+
+func buildHistorySizeKey(name string) []byte {
+	return []byte(dbHistorySizePrefix + dbKeySeparator + name)
+}
+
+// listHistory returns the metadata of all previous versions of key, or of all keys if it's empty,
+// ordered by key and revision.
+func listHistory(txn Txn, name, key string) ([]historyEntry, error) {
+	it := txn.NewIterator(DefaultIteratorOptions)
+	defer it.Close()
+
+	userPrefix := buildHistoryPrefix(dbHistoryMetaPrefix, name, "")
+	prefix := buildHistoryPrefix(dbHistoryMetaPrefix, name, key)
+	entries := make([]historyEntry, 0)
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+		path := string(item.Key()[len(userPrefix):])
+		entry := historyEntry{key: path[:strings.LastIndex(path, dbKeySeparator)]}
+
+		if err := item.Value(func(val []byte) error {
+			return json.Unmarshal(val, &entry.meta)
+		}); err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
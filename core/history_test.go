@@ -0,0 +1,87 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func historySize(t *testing.T) int64 {
+	var size int64
+
+	assert.NoError(t, db().View(func(txn Txn) (err error) {
+		size, err = getHistorySize(txn, "foo")
+		return err
+	}))
+
+	return size
+}
+
+func TestHistoryBudget(t *testing.T) {
+	useTestStore(t, dbBackendBadger)
+	config := Config
+	t.Cleanup(func() { Config = config })
+
+	Config.AppHistorySize = 2
+	Config.AppHistoryMaxSize = 10
+
+	write := func(key, value string) {
+		_, err := SetDataForUser("foo", key, []byte(value), WriteOptions{})
+		assert.NoError(t, err)
+		time.Sleep(time.Millisecond)
+	}
+
+	// Each key keeps its latest versions
+	for _, value := range []string{"1", "22", "333"} {
+		write("a", value)
+	}
+
+	assert.Len(t, collectKeys(t, db(), string(buildHistoryPrefix(dbHistoryPrefix, "foo", "a"))), 2)
+	assert.Equal(t, int64(3), historySize(t))
+
+	// The oldest versions of all keys are removed once the budget is exceeded
+	for _, value := range []string{"4444", "55555", "666666"} {
+		write("b", value)
+	}
+
+	history, err := GetDataHistory("foo", "a")
+	assert.NoError(t, err)
+	assert.Empty(t, history)
+
+	history, err = GetDataHistory("foo", "b")
+	if assert.NoError(t, err) && assert.Len(t, history, 2) {
+		assert.Equal(t, []int64{5, 4}, []int64{history[0].Size, history[1].Size})
+	}
+
+	assert.Equal(t, int64(9), historySize(t))
+	assert.Len(t, collectKeys(t, db(), string(buildHistoryIndexPrefix("foo"))), 2)
+
+	// The size and index are built again for history stored before they were tracked
+	assert.NoError(t, db().Update(func(txn Txn) error {
+		if err := deletePrefix(txn, buildHistoryIndexPrefix("foo")); err != nil {
+			return err
+		}
+
+		return txn.Delete(buildHistorySizeKey("foo"))
+	}))
+
+	write("c", "77")
+	write("c", "8")
+
+	history, err = GetDataHistory("foo", "b")
+	if assert.NoError(t, err) && assert.Len(t, history, 1) {
+		assert.Equal(t, int64(5), history[0].Size)
+	}
+
+	assert.Equal(t, int64(7), historySize(t))
+
+	// Removing a key removes its history from the size and index
+	assert.NoError(t, DeleteDataFromUser("foo", "b", WriteOptions{SkipTrash: true}))
+	assert.Equal(t, int64(2), historySize(t))
+	assert.Len(t, collectKeys(t, db(), string(buildHistoryIndexPrefix("foo"))), 1)
+
+	assert.NoError(t, DeleteUser("foo"))
+	assert.Empty(t, collectKeys(t, db(), string(buildHistoryIndexPrefix("foo"))))
+	assert.Empty(t, collectKeys(t, db(), string(buildHistorySizeKey("foo"))))
+}
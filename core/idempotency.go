@@ -0,0 +1,90 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var ErrIdempotencyKeyInUse = errors.New("a request with this idempotency key is in progress")
+
+var (
+	idempotencyMutex    sync.Mutex
+	idempotencyInFlight = make(map[string]struct{})
+)
+
+// IdempotentResponse is the response of the first successful request made with an idempotency key.
+type IdempotentResponse struct {
+	Hash   string      `json:"hash"` // Hex encoded sha256 of the request
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+}
+
+// LockIdempotencyKey prevents concurrent requests of a user with the same idempotency key,
+// the returned function releases it again.
+func LockIdempotencyKey(name, key string) (func(), error) {
+	id := string(buildIdempotencyKey(name, key))
+
+	idempotencyMutex.Lock()
+	defer idempotencyMutex.Unlock()
+
+	if _, ok := idempotencyInFlight[id]; ok {
+		return nil, ErrIdempotencyKeyInUse
+	}
+
+	idempotencyInFlight[id] = struct{}{}
+
+	return func() {
+		idempotencyMutex.Lock()
+		defer idempotencyMutex.Unlock()
+		delete(idempotencyInFlight, id)
+	}, nil
+}
+
+// GetIdempotentResponse returns the response stored for an idempotency key of a user, or nil if there is none.
+func GetIdempotentResponse(name, key string) (*IdempotentResponse, error) {
+	txn := db().NewTransaction(false)
+	defer txn.Discard()
+
+	item, err := txn.Get(buildIdempotencyKey(name, key))
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	response := &IdempotentResponse{}
+	return response, item.Value(func(val []byte) error {
+		return json.Unmarshal(val, response)
+	})
+}
+
+// StoreIdempotentResponse keeps the response for an idempotency key of a user for the configured duration.
+func StoreIdempotentResponse(name, key string, response *IdempotentResponse) error {
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	return db().Update(func(txn Txn) error {
+		return txn.SetEntry(buildIdempotencyKey(name, key), encoded, time.Now().Add(Config.AppIdempotencyTTL))
+	})
+}
+
+// HashRequest returns the hex encoded sha256 of the given parts of a request.
+func HashRequest(parts ...[]byte) string {
+	var data []byte
+
+	for _, part := range parts {
+		data = append(data, hashData(part)...)
+	}
+
+	return hashData(data)
+}
+
+func buildIdempotencyKey(name, key string) []byte {
+	return []byte(dbIdempotencyPrefix + dbKeySeparator + name + dbKeySeparator + key)
+}
@@ -0,0 +1,293 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The in-memory store keeps an immutable snapshot of all entries which is replaced on every commit,
+// read-write transactions are run one after another. It's meant for tests and ephemeral instances.
+
+var (
+	errTxnDiscarded = errors.New("transaction has been discarded")
+	errTxnReadOnly  = errors.New("transaction is read-only")
+)
+
+type memoryStore struct {
+	writer   sync.Mutex // Held by the read-write transaction in progress
+	mutex    sync.Mutex // Guards snapshot
+	snapshot *memorySnapshot
+}
+
+type memorySnapshot struct {
+	entries map[string]*memoryEntry
+	keys    []string // Sorted keys of entries
+}
+
+type memoryEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+type memoryTxn struct {
+	store    *memoryStore
+	snapshot *memorySnapshot
+	update   bool
+	writes   map[string]*memoryEntry // Deleted keys are nil
+	done     bool
+}
+
+type memoryItem struct {
+	key   []byte
+	entry *memoryEntry
+}
+
+type memoryIterator struct {
+	txn   *memoryTxn
+	keys  []string
+	index int
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{snapshot: &memorySnapshot{entries: make(map[string]*memoryEntry)}}
+}
+
+func (s *memoryStore) NewTransaction(update bool) Txn {
+	if update {
+		s.writer.Lock()
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return &memoryTxn{store: s, snapshot: s.snapshot, update: update, writes: make(map[string]*memoryEntry)}
+}
+
+func (s *memoryStore) View(fn func(txn Txn) error) error {
+	txn := s.NewTransaction(false)
+	defer txn.Discard()
+
+	return fn(txn)
+}
+
+func (s *memoryStore) Update(fn func(txn Txn) error) error {
+	txn := s.NewTransaction(true)
+	defer txn.Discard()
+
+	if err := fn(txn); err != nil {
+		return err
+	}
+
+	return txn.Commit()
+}
+
+func (s *memoryStore) DropAll() error {
+	s.writer.Lock()
+	defer s.writer.Unlock()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.snapshot = &memorySnapshot{entries: make(map[string]*memoryEntry)}
+	return nil
+}
+
+func (s *memoryStore) Backup(w io.Writer, _ uint64) (uint64, error) {
+	return 0, s.View(func(txn Txn) error {
+		return writeBackupStream(txn, w)
+	})
+}
+
+func (s *memoryStore) Load(r io.Reader) error {
+	return loadBackupStream(s, r)
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
+
+func (t *memoryTxn) Get(key []byte) (Item, error) {
+	if entry := t.lookup(string(key)); entry != nil {
+		return &memoryItem{key: key, entry: entry}, nil
+	}
+
+	return nil, ErrKeyNotFound
+}
+
+func (t *memoryTxn) Set(key, value []byte) error {
+	return t.SetEntry(key, value, time.Time{})
+}
+
+func (t *memoryTxn) SetEntry(key, value []byte, expiresAt time.Time) error {
+	if t.done {
+		return errTxnDiscarded
+	} else if !t.update {
+		return errTxnReadOnly
+	}
+
+	t.writes[string(key)] = &memoryEntry{value: bytes.Clone(value), expiresAt: expiresAt}
+	return nil
+}
+
+func (t *memoryTxn) Delete(key []byte) error {
+	if t.done {
+		return errTxnDiscarded
+	} else if !t.update {
+		return errTxnReadOnly
+	}
+
+	t.writes[string(key)] = nil
+	return nil
+}
+
+func (t *memoryTxn) NewIterator(IteratorOptions) Iterator {
+	keys := t.snapshot.keys
+
+	// Merge the keys written by this transaction
+	if len(t.writes) > 0 {
+		keys = slices.Clone(keys)
+
+		for key, entry := range t.writes {
+			if _, exists := t.snapshot.entries[key]; !exists && entry != nil {
+				keys = append(keys, key)
+			}
+		}
+
+		slices.Sort(keys)
+	}
+
+	return &memoryIterator{txn: t, keys: keys}
+}
+
+// Commit replaces the snapshot of the store with one including the writes of the transaction,
+// expired entries are dropped on the way.
+func (t *memoryTxn) Commit() error {
+	if t.done {
+		return errTxnDiscarded
+	} else if !t.update || len(t.writes) == 0 {
+		t.Discard()
+		return nil
+	}
+
+	now := time.Now()
+	snapshot := &memorySnapshot{entries: make(map[string]*memoryEntry, len(t.snapshot.entries)+len(t.writes))}
+
+	for key, entry := range t.snapshot.entries {
+		if entry.alive(now) {
+			snapshot.entries[key] = entry
+		}
+	}
+
+	for key, entry := range t.writes {
+		if entry == nil {
+			delete(snapshot.entries, key)
+		} else {
+			snapshot.entries[key] = entry
+		}
+	}
+
+	snapshot.keys = make([]string, 0, len(snapshot.entries))
+	for key := range snapshot.entries {
+		snapshot.keys = append(snapshot.keys, key)
+	}
+
+	slices.Sort(snapshot.keys)
+
+	t.store.mutex.Lock()
+	t.store.snapshot = snapshot
+	t.store.mutex.Unlock()
+
+	t.Discard()
+	return nil
+}
+
+func (t *memoryTxn) Discard() {
+	if t.done {
+		return
+	}
+
+	t.done = true
+	if t.update {
+		t.store.writer.Unlock()
+	}
+}
+
+// lookup returns the entry of key as seen by the transaction, or nil if there is none.
+func (t *memoryTxn) lookup(key string) *memoryEntry {
+	entry, written := t.writes[key]
+	if !written {
+		entry = t.snapshot.entries[key]
+	}
+
+	if entry != nil && entry.alive(time.Now()) {
+		return entry
+	}
+
+	return nil
+}
+
+func (e *memoryEntry) alive(now time.Time) bool {
+	return e.expiresAt.IsZero() || e.expiresAt.After(now)
+}
+
+func (i *memoryItem) Key() []byte {
+	return i.key
+}
+
+func (i *memoryItem) KeyCopy(dst []byte) []byte {
+	return append(dst[:0], i.key...)
+}
+
+func (i *memoryItem) Value(fn func(val []byte) error) error {
+	return fn(i.entry.value)
+}
+
+func (i *memoryItem) ValueCopy(dst []byte) ([]byte, error) {
+	return append(dst[:0], i.entry.value...), nil
+}
+
+func (i *memoryItem) ExpiresAt() time.Time {
+	return i.entry.expiresAt
+}
+
+func (i *memoryIterator) Rewind() {
+	i.index = 0
+	i.skip()
+}
+
+func (i *memoryIterator) Seek(key []byte) {
+	i.index = sort.SearchStrings(i.keys, string(key))
+	i.skip()
+}
+
+func (i *memoryIterator) Valid() bool {
+	return i.index < len(i.keys)
+}
+
+func (i *memoryIterator) ValidForPrefix(prefix []byte) bool {
+	return i.Valid() && bytes.HasPrefix([]byte(i.keys[i.index]), prefix)
+}
+
+func (i *memoryIterator) Next() {
+	i.index++
+	i.skip()
+}
+
+func (i *memoryIterator) Item() Item {
+	key := i.keys[i.index]
+	return &memoryItem{key: []byte(key), entry: i.txn.lookup(key)}
+}
+
+func (i *memoryIterator) Close() {}
+
+// skip moves the iterator past deleted and expired keys.
+func (i *memoryIterator) skip() {
+	for i.index < len(i.keys) && i.txn.lookup(i.keys[i.index]) == nil {
+		i.index++
+	}
+}
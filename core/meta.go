@@ -0,0 +1,287 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// DataMeta is stored alongside each value under the meta prefix.
+type DataMeta struct {
+	Revision uint64    `json:"revision"`
+	Modified time.Time `json:"modified,omitzero"`
+	Size     int64     `json:"size"`
+	Hash     string    `json:"hash"` // Hex encoded sha256 of the value
+	Expires  time.Time `json:"expires,omitzero"`
+	Sequence uint64    `json:"sequence,omitempty"` // Position in the change sequence of the user
+}
+
+type WriteOptions struct {
+
+	// Precondition is called with the metadata of the currently stored value, or nil if there is none,
+	// within the same transaction as the write. The write is rejected with ErrPreconditionFailed if it returns false.
+	Precondition func(current *DataMeta) bool
+
+	// Expires is the time the value vanishes on its own, it's kept forever if zero.
+	Expires time.Time
+
+	// KeepExpiration makes the value inherit the expiration of the currently stored one if Expires is zero.
+	KeepExpiration bool
+
+	// SkipTrash removes deleted values right away instead of moving them into the trash.
+	SkipTrash bool
+}
+
+func (o WriteOptions) check(current *DataMeta) error {
+	if o.Precondition != nil && !o.Precondition(current) {
+		return ErrPreconditionFailed
+	}
+
+	return nil
+}
+
+func getMeta(txn Txn, name, key string) (*DataMeta, error) {
+	meta := &DataMeta{}
+
+	if item, err := txn.Get(buildUserMetaKey(name, key)); err == nil {
+		if err := item.Value(func(val []byte) error {
+			return json.Unmarshal(val, meta)
+		}); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, ErrKeyNotFound) {
+		return nil, err
+	}
+
+	// Values stored before their metadata was tracked are missing some or all of it
+	if meta.Hash == "" {
+		item, err := txn.Get(buildUserDataKey(name, key))
+		if errors.Is(err, ErrKeyNotFound) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		data, err := readValue(item)
+		if err != nil {
+			return nil, err
+		}
+
+		completeMeta(meta, data)
+	}
+
+	return meta, nil
+}
+
+func setData(txn Txn, name, key string, data []byte, opts WriteOptions) (*DataMeta, error) {
+	current, err := getMeta(txn, name, key)
+	if err != nil {
+		return nil, err
+	} else if err := opts.check(current); err != nil {
+		return nil, err
+	} else if err := validateData(txn, key, data); err != nil {
+		return nil, err
+	}
+
+	meta := DataMeta{
+		Modified: time.Now().UTC(),
+		Size:     int64(len(data)),
+		Hash:     hashData(data),
+	}
+
+	// Expirations are stored in seconds, rounded up to not expire early
+	if !opts.Expires.IsZero() {
+		meta.Expires = opts.Expires.Add(time.Second - 1).Truncate(time.Second).UTC()
+	} else if opts.KeepExpiration && current != nil {
+		meta.Expires = current.Expires
+	}
+
+	delta := meta.Size
+	if current != nil {
+		delta -= current.Size
+	}
+
+	if err := adjustUsage(txn, name, delta); err != nil {
+		return nil, err
+	}
+
+	if meta.Sequence, err = nextSequence(txn, name); err != nil {
+		return nil, err
+	} else if err := removeTombstone(txn, name, key); err != nil {
+		return nil, err
+	}
+
+	// New keys start at the sequence of the user, which is never lower than a revision handed out before.
+	// That way revisions of deleted or expired values aren't reused and stale preconditions keep failing.
+	meta.Revision = meta.Sequence
+
+	if current != nil {
+		meta.Revision = current.Revision + 1
+
+		if err := pushHistory(txn, name, key, current); err != nil {
+			return nil, err
+		} else if err := removeExpiration(txn, name, key, current); err != nil {
+			return nil, err
+		}
+	} else if err := deleteHistory(txn, name, key); err != nil { // Left behind by an expired value
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := txn.SetEntry(buildUserDataKey(name, key), encodeValue(data), meta.Expires); err != nil {
+		return nil, err
+	} else if err := txn.SetEntry(buildUserMetaKey(name, key), encoded, meta.Expires); err != nil {
+		return nil, err
+	}
+
+	return &meta, addExpiration(txn, name, key, &meta)
+}
+
+// deleteData removes key and returns the metadata of the removed value, or nil if there was none.
+func deleteData(txn Txn, name, key string, opts WriteOptions) (*DataMeta, error) {
+	current, err := getMeta(txn, name, key)
+	if err != nil {
+		return nil, err
+	} else if err := opts.check(current); err != nil {
+		return nil, err
+	} else if current == nil {
+		return nil, nil
+	} else if err := adjustUsage(txn, name, -current.Size); err != nil {
+		return nil, err
+	} else if err := removeExpiration(txn, name, key, current); err != nil {
+		return nil, err
+	}
+
+	if !opts.SkipTrash {
+		if err := trashData(txn, name, key, current); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := txn.Delete(buildUserDataKey(name, key)); err != nil {
+		return nil, err
+	} else if err := txn.Delete(buildUserMetaKey(name, key)); err != nil {
+		return nil, err
+	} else if err := addTombstone(txn, name, key); err != nil {
+		return nil, err
+	}
+
+	return current, deleteHistory(txn, name, key)
+}
+
+// updateData replaces the currently stored value of key with the result of fn and returns it.
+func updateData(txn Txn, name, key string, fn func(current []byte) ([]byte, error), opts WriteOptions) (*DataMeta, []byte, error) {
+	item, err := txn.Get(buildUserDataKey(name, key))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	current, err := readValue(item)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := fn(current)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts.KeepExpiration = true
+	meta, err := setData(txn, name, key, data, opts)
+	return meta, data, err
+}
+
+// copyData stores the value of key as target, which must not exist unless overwrite is set, and removes key if move is set.
+// The precondition applies to key, the copy keeps its expiration. Returns the metadata of target and its value.
+func copyData(txn Txn, name, key, target string, overwrite, move bool, opts WriteOptions) (*DataMeta, []byte, error) {
+	item, err := txn.Get(buildUserDataKey(name, key))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := readValue(item)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	current, err := getMeta(txn, name, key)
+	if err != nil {
+		return nil, nil, err
+	} else if err := opts.check(current); err != nil {
+		return nil, nil, err
+	}
+
+	if existing, err := getMeta(txn, name, target); err != nil {
+		return nil, nil, err
+	} else if existing != nil && !overwrite {
+		return nil, nil, ErrKeyExists
+	}
+
+	// Remove the source first to not exceed the quota with both of them
+	if move {
+		if _, err := deleteData(txn, name, key, WriteOptions{SkipTrash: true}); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	meta, err := setData(txn, name, target, data, WriteOptions{Expires: current.Expires})
+	if err != nil {
+		return nil, nil, err
+	} else if countKeys(txn, name) > Config.AppKeysPerUser {
+		return nil, nil, ErrTooManyKeys
+	}
+
+	return meta, data, nil
+}
+
+// GetAllMetaFromUser returns the metadata of all keys without reading their values,
+// except for values stored before their metadata was tracked.
+func GetAllMetaFromUser(name string) (map[string]*DataMeta, error) {
+	txn := db().NewTransaction(false)
+	defer txn.Discard()
+
+	return getAllMeta(txn, name)
+}
+
+func getAllMeta(txn Txn, name string) (map[string]*DataMeta, error) {
+	opts := DefaultIteratorOptions
+	opts.PrefetchValues = false
+
+	it := txn.NewIterator(opts)
+	defer it.Close()
+
+	prefix := buildUserDataKey(name, "")
+	out := make(map[string]*DataMeta)
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		key := string(it.Item().Key()[len(prefix):])
+
+		meta, err := getMeta(txn, name, key)
+		if err != nil {
+			return nil, err
+		}
+
+		out[key] = meta
+	}
+
+	return out, nil
+}
+
+// completeMeta fills in the size and hash of metadata stored before they were tracked.
+func completeMeta(meta *DataMeta, data []byte) {
+	meta.Size = int64(len(data))
+	meta.Hash = hashData(data)
+}
+
+func hashData(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,231 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Amount of keys written per transaction by MigrateDatabase
+const migrateBatchSize = 1000
+
+var (
+	ErrMigrateInMemory       = errors.New("the in-memory database can't be migrated")
+	ErrMigrateSameDatabase   = errors.New("source and target are the same database")
+	ErrMigrateTargetNotEmpty = errors.New("target database is not empty")
+)
+
+// MigrationResult is the amount of keys copied by MigrateDatabase.
+type MigrationResult struct {
+	Users  int
+	Data   int
+	Tokens int // Blacklisted tokens which are still valid
+	Total  int
+}
+
+type migratedEntry struct {
+	key       []byte
+	value     []byte
+	expiresAt time.Time
+}
+
+// migratedKeys tracks the keys copied with a prefix, including when the ones with a time to live expire.
+type migratedKeys struct {
+	count     int
+	expiresAt []time.Time
+}
+
+// MigrateDatabase copies all keys from one database to an empty one, locations are given as <backend>:<path>
+// like in GENESIS_DB_PATH. Keys keep their remaining time to live, the amount of keys in the target is
+// verified afterwards. Badger databases are opened with the configured encryption key, neither may be in use.
+func MigrateDatabase(from, to string) (*MigrationResult, error) {
+	fromBackend, fromPath := parseStoreLocation(from)
+	toBackend, toPath := parseStoreLocation(to)
+
+	if fromBackend == dbBackendMemory || toBackend == dbBackendMemory {
+		return nil, ErrMigrateInMemory
+	} else if fromPath == toPath {
+		return nil, ErrMigrateSameDatabase
+	} else if _, err := os.Stat(fromPath); err != nil {
+		return nil, fmt.Errorf("failed to open source database: %w", err)
+	}
+
+	source, err := openMigrationStore(fromBackend, fromPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source database: %w", err)
+	}
+	defer source.Close()
+
+	target, err := openMigrationStore(toBackend, toPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open target database: %w", err)
+	}
+	defer target.Close()
+
+	if counts, err := countPrefixes(target); err != nil {
+		return nil, err
+	} else if len(counts) > 0 {
+		return nil, ErrMigrateTargetNotEmpty
+	}
+
+	copied, err := copyKeys(source, target)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyMigration(target, copied); err != nil {
+		return nil, err
+	}
+
+	result := &MigrationResult{}
+	for prefix, keys := range copied {
+		switch prefix {
+		case dbUserPrefix:
+			result.Users = keys.count
+		case dbDataPrefix:
+			result.Data = keys.count
+		case dbExpiredTokenPrefix:
+			result.Tokens = keys.count
+		}
+
+		result.Total += keys.count
+	}
+
+	return result, nil
+}
+
+func openMigrationStore(backend, path string) (Store, error) {
+	if backend == dbBackendBadger {
+		return openStore(backend, path, Config.DbEncryptionKey)
+	}
+
+	return openStore(backend, path, nil)
+}
+
+// copyKeys copies all keys of source to target in batches and returns what has been copied by prefix.
+func copyKeys(source, target Store) (map[string]*migratedKeys, error) {
+	copied := make(map[string]*migratedKeys)
+	batch := make([]migratedEntry, 0, migrateBatchSize)
+
+	flush := func() error {
+		err := target.Update(func(txn Txn) error {
+			for _, entry := range batch {
+				if err := txn.SetEntry(entry.key, entry.value, entry.expiresAt); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+
+		batch = batch[:0]
+		return err
+	}
+
+	err := source.View(func(txn Txn) error {
+		it := txn.NewIterator(DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			item := it.Item()
+
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+
+			entry := migratedEntry{key: item.KeyCopy(nil), value: value, expiresAt: item.ExpiresAt()}
+			prefix := keyPrefix(entry.key)
+
+			if copied[prefix] == nil {
+				copied[prefix] = &migratedKeys{}
+			}
+
+			copied[prefix].count++
+			if !entry.expiresAt.IsZero() {
+				copied[prefix].expiresAt = append(copied[prefix].expiresAt, entry.expiresAt)
+			}
+
+			if batch = append(batch, entry); len(batch) == migrateBatchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	} else if len(batch) > 0 {
+		return copied, flush()
+	}
+
+	return copied, nil
+}
+
+// verifyMigration compares the keys in target with the copied ones, keys may have expired in the meantime.
+func verifyMigration(target Store, copied map[string]*migratedKeys) error {
+	before := time.Now()
+
+	counts, err := countPrefixes(target)
+	if err != nil {
+		return err
+	}
+
+	after := time.Now()
+
+	for prefix := range counts {
+		if copied[prefix] == nil {
+			return fmt.Errorf("verification failed: found %v unexpected keys with prefix %v", counts[prefix], prefix)
+		}
+	}
+
+	for prefix, keys := range copied {
+		if found, least, most := counts[prefix], keys.alive(after), keys.alive(before); found < least || found > most {
+			return fmt.Errorf("verification failed: expected %v keys with prefix %v but found %v", most, prefix, found)
+		}
+	}
+
+	return nil
+}
+
+// alive returns the amount of keys which haven't expired at the given time.
+func (k *migratedKeys) alive(at time.Time) int {
+	alive := k.count
+
+	for _, expiresAt := range k.expiresAt {
+		if expiresAt.Unix() <= at.Unix() {
+			alive--
+		}
+	}
+
+	return alive
+}
+
+// countPrefixes returns the amount of keys in store by prefix.
+func countPrefixes(store Store) (map[string]int, error) {
+	counts := make(map[string]int)
+
+	return counts, store.View(func(txn Txn) error {
+		opts := DefaultIteratorOptions
+		opts.PrefetchValues = false
+
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Rewind(); it.Valid(); it.Next() {
+			counts[keyPrefix(it.Item().Key())]++
+		}
+
+		return nil
+	})
+}
+
+func keyPrefix(key []byte) string {
+	prefix, _, _ := strings.Cut(string(key), dbKeySeparator)
+	return prefix
+}
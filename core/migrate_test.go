@@ -0,0 +1,103 @@
+package core
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateDatabase(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "badger")
+	expiresAt := time.Now().Add(time.Hour)
+
+	store, err := openStore(dbBackendBadger, source, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, store.Update(func(txn Txn) error {
+		return errors.Join(
+			txn.Set(buildUserKey("foo"), []byte("{}")),
+			txn.Set(buildUserDataKey("foo", "a"), []byte("1")),
+			txn.Set(buildUserDataKey("foo", "b"), []byte("2")),
+			txn.SetEntry(buildExpiredKey("valid"), []byte{}, expiresAt),
+			txn.SetEntry(buildExpiredKey("expired"), []byte{}, time.Now().Add(-time.Second)),
+		)
+	}))
+
+	assert.NoError(t, store.Close())
+
+	// Keys are copied with their time to live, expired ones are skipped
+	result, err := MigrateDatabase(source, "bolt:"+filepath.Join(dir, "bolt.db"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, MigrationResult{Users: 1, Data: 2, Tokens: 1, Total: 4}, *result)
+	}
+
+	result, err = MigrateDatabase("bolt:"+filepath.Join(dir, "bolt.db"), "badger:"+filepath.Join(dir, "copy"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, MigrationResult{Users: 1, Data: 2, Tokens: 1, Total: 4}, *result)
+	}
+
+	copied, err := openStore(dbBackendBadger, filepath.Join(dir, "copy"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer copied.Close()
+
+	assert.NoError(t, copied.View(func(txn Txn) error {
+		item, err := txn.Get(buildUserDataKey("foo", "b"))
+		if assert.NoError(t, err) {
+			value, _ := item.ValueCopy(nil)
+			assert.Equal(t, "2", string(value))
+		}
+
+		item, err = txn.Get(buildExpiredKey("valid"))
+		if assert.NoError(t, err) {
+			assert.Equal(t, expiresAt.Unix(), item.ExpiresAt().Unix())
+		}
+
+		return nil
+	}))
+
+	_, err = MigrateDatabase(source, "badger:"+source)
+	assert.ErrorIs(t, err, ErrMigrateSameDatabase)
+
+	_, err = MigrateDatabase(source, "bolt:"+filepath.Join(dir, "bolt.db"))
+	assert.ErrorIs(t, err, ErrMigrateTargetNotEmpty)
+
+	_, err = MigrateDatabase(source, dbMemoryPath)
+	assert.ErrorIs(t, err, ErrMigrateInMemory)
+
+	_, err = MigrateDatabase(filepath.Join(dir, "missing"), filepath.Join(dir, "other"))
+	assert.Error(t, err)
+}
+
+func TestVerifyMigration(t *testing.T) {
+	target := openTestStore(t, dbBackendMemory)
+
+	assert.NoError(t, target.Update(func(txn Txn) error {
+		return errors.Join(
+			txn.Set(buildUserDataKey("foo", "a"), []byte("1")),
+			txn.SetEntry(buildExpiredKey("token"), []byte{}, time.Now().Add(time.Hour)),
+		)
+	}))
+
+	expiring := &migratedKeys{count: 2, expiresAt: []time.Time{time.Now().Add(-time.Second)}}
+	assert.NoError(t, verifyMigration(target, map[string]*migratedKeys{
+		dbDataPrefix:         {count: 1},
+		dbExpiredTokenPrefix: expiring, // One of them expired after it has been copied
+	}))
+
+	assert.ErrorContains(t, verifyMigration(target, map[string]*migratedKeys{
+		dbDataPrefix:         {count: 2},
+		dbExpiredTokenPrefix: {count: 1},
+	}), "expected 2 keys with prefix dat but found 1")
+
+	assert.ErrorContains(t, verifyMigration(target, map[string]*migratedKeys{
+		dbDataPrefix: {count: 1},
+	}), "unexpected keys with prefix exp")
+}
@@ -0,0 +1,185 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPointer  = errors.New("json pointer must be empty or start with a slash")
+	ErrPointerNotFound = errors.New("json pointer does not resolve")
+)
+
+type jsonMember struct {
+	key   string
+	value json.RawMessage
+}
+
+// fieldSelection is a tree of selected members, a nil selection selects a member entirely.
+type fieldSelection map[string]fieldSelection
+
+// ResolvePointer returns the part of doc referenced by the JSON Pointer (RFC 6901).
+func ResolvePointer(doc []byte, pointer string) ([]byte, error) {
+	if pointer == "" {
+		return doc, nil
+	} else if !strings.HasPrefix(pointer, "/") {
+		return nil, ErrInvalidPointer
+	}
+
+	current := json.RawMessage(doc)
+	for _, token := range parsePointer(pointer[1:]) {
+		trimmed := bytes.TrimSpace(current)
+
+		if len(trimmed) == 0 {
+			return nil, ErrPointerNotFound
+		}
+
+		switch trimmed[0] {
+		case '{':
+			members, err := parseObject(trimmed)
+			if err != nil {
+				return nil, err
+			}
+
+			found := false
+			for _, member := range members {
+				if member.key == token {
+					current, found = member.value, true
+				}
+			}
+
+			if !found {
+				return nil, ErrPointerNotFound
+			}
+		case '[':
+			var items []json.RawMessage
+			if err := json.Unmarshal(trimmed, &items); err != nil {
+				return nil, err
+			}
+
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(items) || (len(token) > 1 && token[0] == '0') {
+				return nil, ErrPointerNotFound
+			}
+
+			current = items[index]
+		default:
+			return nil, ErrPointerNotFound
+		}
+	}
+
+	return current, nil
+}
+
+// ProjectFields returns an object with only the given fields of doc, nested fields are separated by a slash.
+// Fields which don't exist are omitted, the order of the members in doc is kept.
+func ProjectFields(doc []byte, fields []string) ([]byte, error) {
+	selection := make(fieldSelection)
+
+	for _, field := range fields {
+		current := selection
+		tokens := parsePointer(strings.TrimPrefix(field, "/"))
+
+		for i, token := range tokens {
+			next, exists := current[token]
+
+			if exists && next == nil {
+				break // Parent is already selected entirely
+			} else if i == len(tokens)-1 {
+				current[token] = nil
+			} else if !exists {
+				next = make(fieldSelection)
+				current[token] = next
+			}
+
+			current = next
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := projectObject(&buf, doc, selection); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func projectObject(buf *bytes.Buffer, doc []byte, selection fieldSelection) error {
+	trimmed := bytes.TrimSpace(doc)
+	buf.WriteByte('{')
+
+	if len(trimmed) != 0 && trimmed[0] == '{' {
+		members, err := parseObject(trimmed)
+		if err != nil {
+			return err
+		}
+
+		written := false
+		for _, member := range members {
+			nested, selected := selection[member.key]
+
+			if !selected {
+				continue
+			} else if written {
+				buf.WriteByte(',')
+			}
+
+			key, err := json.Marshal(member.key)
+			if err != nil {
+				return err
+			}
+
+			buf.Write(key)
+			buf.WriteByte(':')
+			written = true
+
+			if nested == nil {
+				buf.Write(member.value)
+			} else if err := projectObject(buf, member.value, nested); err != nil {
+				return err
+			}
+		}
+	}
+
+	buf.WriteByte('}')
+	return nil
+}
+
+// parseObject returns the members of a json object in their original order.
+func parseObject(data []byte) ([]jsonMember, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	members := make([]jsonMember, 0)
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		member := jsonMember{key: token.(string)}
+		if err := decoder.Decode(&member.value); err != nil {
+			return nil, err
+		}
+
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+func parsePointer(pointer string) []string {
+	tokens := strings.Split(pointer, "/")
+
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+
+	return tokens
+}
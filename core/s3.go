@@ -0,0 +1,346 @@
+package core
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A minimal client for S3-compatible object storage, requests are signed with AWS Signature Version 4
+// and objects are addressed path-style as <endpoint>/<bucket>/<key>, which all implementations support.
+
+const (
+	s3Service      = "s3"
+	s3Algorithm    = "AWS4-HMAC-SHA256"
+	s3TimeFormat   = "20060102T150405Z"
+	s3DateFormat   = "20060102"
+	s3RequestLimit = 10 * time.Minute
+)
+
+var ErrS3NotConfigured = errors.New("object storage is not configured, set GENESIS_S3_ENDPOINT, GENESIS_S3_ACCESS_KEY and GENESIS_S3_SECRET_KEY")
+
+type s3Client struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	partSize  int64
+	client    *http.Client
+}
+
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+type s3InitiateMultipartUploadResult struct {
+	UploadId string `xml:"UploadId"`
+}
+
+type s3CompleteMultipartUpload struct {
+	XMLName xml.Name         `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletePart `xml:"Part"`
+}
+
+type s3CompletePart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type s3ListBucketResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// newS3Client returns a client for bucket using the configured endpoint and credentials.
+func newS3Client(bucket string) (*s3Client, error) {
+	if Config.S3Endpoint == "" || Config.S3AccessKey == "" || Config.S3SecretKey == "" || bucket == "" {
+		return nil, ErrS3NotConfigured
+	}
+
+	endpoint, err := url.Parse(Config.S3Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GENESIS_S3_ENDPOINT: %w", err)
+	}
+
+	return &s3Client{
+		endpoint:  endpoint,
+		region:    Config.S3Region,
+		bucket:    bucket,
+		accessKey: Config.S3AccessKey,
+		secretKey: Config.S3SecretKey,
+		partSize:  Config.S3PartSize,
+		client:    &http.Client{Timeout: s3RequestLimit},
+	}, nil
+}
+
+// upload stores a file as key, files larger than the part size are uploaded in parts.
+func (s *s3Client) upload(key string, file *os.File) error {
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if stat.Size() <= s.partSize {
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return err
+		}
+
+		_, err = s.request(http.MethodPut, key, nil, data)
+		return err
+	}
+
+	body, err := s.request(http.MethodPost, key, url.Values{"uploads": {""}}, nil)
+	if err != nil {
+		return err
+	}
+
+	var upload s3InitiateMultipartUploadResult
+	if err := xml.Unmarshal(body, &upload); err != nil {
+		return err
+	}
+
+	if err := s.uploadParts(key, upload.UploadId, file); err != nil {
+		if _, abortErr := s.request(http.MethodDelete, key, url.Values{"uploadId": {upload.UploadId}}, nil); abortErr != nil {
+			return errors.Join(err, abortErr)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+func (s *s3Client) uploadParts(key, uploadId string, file *os.File) error {
+	complete := s3CompleteMultipartUpload{}
+	part := make([]byte, s.partSize)
+
+	for number := 1; ; number++ {
+		size, err := io.ReadFull(file, part)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadId}}
+		response, err := s.do(http.MethodPut, key, query, part[:size])
+		if err != nil {
+			return err
+		}
+
+		_ = response.Body.Close()
+		complete.Parts = append(complete.Parts, s3CompletePart{PartNumber: number, ETag: response.Header.Get("ETag")})
+	}
+
+	encoded, err := xml.Marshal(complete)
+	if err != nil {
+		return err
+	}
+
+	body, err := s.request(http.MethodPost, key, url.Values{"uploadId": {uploadId}}, encoded)
+	if err != nil {
+		return err
+	}
+
+	// Completing an upload may fail after the response status has been sent already
+	var details s3Error
+	if xml.Unmarshal(body, &details) == nil && details.Code != "" {
+		return fmt.Errorf("s3: completing upload of %s: %s: %s", key, details.Code, details.Message)
+	}
+
+	return nil
+}
+
+// download writes the object stored as key to w.
+func (s *s3Client) download(key string, w io.Writer) error {
+	response, err := s.do(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	_, err = io.Copy(w, response.Body)
+	return err
+}
+
+// list returns the keys of all objects starting with prefix in ascending order.
+func (s *s3Client) list(prefix string) ([]string, error) {
+	var keys []string
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+
+	for {
+		body, err := s.request(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var result s3ListBucketResult
+		if err := xml.Unmarshal(body, &result); err != nil {
+			return nil, err
+		}
+
+		for _, content := range result.Contents {
+			keys = append(keys, content.Key)
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+
+	slices.Sort(keys)
+	return keys, nil
+}
+
+func (s *s3Client) delete(key string) error {
+	_, err := s.request(http.MethodDelete, key, nil, nil)
+	return err
+}
+
+// request is like do but returns the body of the response.
+func (s *s3Client) request(method, key string, query url.Values, payload []byte) ([]byte, error) {
+	response, err := s.do(method, key, query, payload)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	return io.ReadAll(response.Body)
+}
+
+// do sends a signed request for key, responses without a 2xx status are returned as error.
+func (s *s3Client) do(method, key string, query url.Values, payload []byte) (*http.Response, error) {
+	path := strings.TrimSuffix(s.endpoint.Path, "/") + "/" + s.bucket
+	if key != "" {
+		path += "/" + key
+	}
+
+	target := *s.endpoint
+	target.Path = path
+	target.RawPath = s3Escape(path, false)
+	target.RawQuery = s3CanonicalQuery(query)
+
+	request, err := http.NewRequest(method, target.String(), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	s.sign(request, payload, time.Now())
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, err
+	} else if response.StatusCode < 200 || response.StatusCode > 299 {
+		defer response.Body.Close()
+
+		var details s3Error
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 64<<10))
+		if xml.Unmarshal(body, &details) == nil && details.Code != "" {
+			return nil, fmt.Errorf("s3: %s %s: %s: %s", method, path, details.Code, details.Message)
+		}
+
+		return nil, fmt.Errorf("s3: %s %s: %s", method, path, response.Status)
+	}
+
+	return response, nil
+}
+
+// sign adds the headers of Signature Version 4 to request.
+func (s *s3Client) sign(request *http.Request, payload []byte, now time.Time) {
+	now = now.UTC()
+	payloadHash := sha256.Sum256(payload)
+
+	request.Header.Set("Host", request.URL.Host)
+	request.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	request.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	names := make([]string, 0, len(request.Header))
+	for name := range request.Header {
+		names = append(names, strings.ToLower(name))
+	}
+
+	slices.Sort(names)
+
+	var headers strings.Builder
+	for _, name := range names {
+		headers.WriteString(name + ":" + strings.TrimSpace(request.Header.Get(name)) + "\n")
+	}
+
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.RawQuery,
+		headers.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := now.Format(s3DateFormat) + "/" + s.region + "/" + s3Service + "/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := s3Algorithm + "\n" + now.Format(s3TimeFormat) + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := s3HMAC([]byte("AWS4"+s.secretKey), now.Format(s3DateFormat))
+	key = s3HMAC(key, s.region)
+	key = s3HMAC(key, s3Service)
+	key = s3HMAC(key, "aws4_request")
+
+	request.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, s.accessKey, scope, signedHeaders, hex.EncodeToString(s3HMAC(key, stringToSign))))
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3CanonicalQuery encodes query sorted by its keys, as required for signing.
+func s3CanonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, s3Escape(key, true)+"="+s3Escape(value, true))
+		}
+	}
+
+	slices.Sort(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// s3Escape percent-encodes everything but unreserved characters, slashes are kept unless escapeSlash is set.
+func s3Escape(value string, escapeSlash bool) string {
+	var escaped strings.Builder
+
+	for _, b := range []byte(value) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' || (b == '/' && !escapeSlash) {
+			escaped.WriteByte(b)
+		} else {
+			escaped.WriteString(fmt.Sprintf("%%%02X", b))
+		}
+	}
+
+	return escaped.String()
+}
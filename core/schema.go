@@ -0,0 +1,250 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+var (
+	ErrSchemaNotFound = errors.New("schema not found")
+	ErrInvalidSchema  = errors.New("invalid schema")
+)
+
+var (
+	compiledSchemasMutex sync.Mutex
+	compiledSchemas      = make(map[string]*compiledSchema) // Compiled schemas by their name
+)
+
+// Schema is a JSON Schema (draft 2020-12) values of matching keys have to satisfy.
+type Schema struct {
+	Name    string          `json:"name"`
+	Key     string          `json:"key,omitempty"`     // Exact key name
+	Pattern string          `json:"pattern,omitempty"` // Regular expression matching the whole key
+	Schema  json.RawMessage `json:"schema"`
+	hash    string          // Hash of the stored schema
+}
+
+// compiledSchema is a schema ready to validate values, compiled from the stored schema with the same hash.
+type compiledSchema struct {
+	hash    string
+	key     string
+	pattern *regexp.Regexp
+	schema  *jsonschema.Schema
+}
+
+type SchemaViolation struct {
+	Path    string `json:"path"` // JSON Pointer to the violating part
+	Message string `json:"message"`
+}
+
+// SchemaError is returned by writes of values violating one of the schemas of their key.
+type SchemaError struct {
+	Schema     string
+	Violations []SchemaViolation
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("value violates schema %s", e.Schema)
+}
+
+func (s *compiledSchema) matches(key string) bool {
+	if s.key != "" {
+		return s.key == key
+	}
+
+	return s.pattern.MatchString(key)
+}
+
+// SetSchema creates or replaces a schema, ErrInvalidSchema is returned if it can't be compiled.
+func SetSchema(schema Schema) error {
+	if schema.Name == "" || !Config.AppKeyPattern.MatchString(schema.Name) {
+		return fmt.Errorf("%w: name must match %s", ErrInvalidSchema, Config.AppKeyPattern.String())
+	} else if (schema.Key == "") == (schema.Pattern == "") {
+		return fmt.Errorf("%w: either a key or a pattern is required", ErrInvalidSchema)
+	}
+
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return err
+	}
+
+	schema.hash = hashData(data)
+	compiled, err := newCompiledSchema(&schema)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSchema, err)
+	}
+
+	if err := db().Update(func(txn Txn) error {
+		return txn.Set(buildSchemaKey(schema.Name), data)
+	}); err != nil {
+		return err
+	}
+
+	compiledSchemasMutex.Lock()
+	defer compiledSchemasMutex.Unlock()
+
+	compiledSchemas[schema.Name] = compiled
+	return nil
+}
+
+func DeleteSchema(name string) error {
+	if err := db().Update(func(txn Txn) error {
+		if _, err := txn.Get(buildSchemaKey(name)); errors.Is(err, ErrKeyNotFound) {
+			return ErrSchemaNotFound
+		} else if err != nil {
+			return err
+		}
+
+		return txn.Delete(buildSchemaKey(name))
+	}); err != nil {
+		return err
+	}
+
+	compiledSchemasMutex.Lock()
+	defer compiledSchemasMutex.Unlock()
+
+	delete(compiledSchemas, name)
+	return nil
+}
+
+func GetSchemas() ([]*Schema, error) {
+	txn := db().NewTransaction(false)
+	defer txn.Discard()
+
+	return getSchemas(txn)
+}
+
+func getSchemas(txn Txn) ([]*Schema, error) {
+	it := txn.NewIterator(DefaultIteratorOptions)
+	defer it.Close()
+
+	prefix := buildSchemaKey("")
+	schemas := make([]*Schema, 0)
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		schema := &Schema{}
+
+		if err := it.Item().Value(func(val []byte) error {
+			schema.hash = hashData(val)
+			return json.Unmarshal(val, schema)
+		}); err != nil {
+			return nil, err
+		}
+
+		schemas = append(schemas, schema)
+	}
+
+	return schemas, nil
+}
+
+// validateData checks data against all schemas matching key, a *SchemaError is returned for the first one it violates.
+func validateData(txn Txn, key string, data []byte) error {
+	schemas, err := getSchemas(txn)
+	if err != nil {
+		return err
+	}
+
+	for _, schema := range schemas {
+		compiled, err := compileSchema(schema)
+		if err != nil {
+			return err
+		} else if !compiled.matches(key) {
+			continue
+		}
+
+		instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+
+		var validationErr *jsonschema.ValidationError
+		if err := compiled.schema.Validate(instance); errors.As(err, &validationErr) {
+			return &SchemaError{Schema: schema.Name, Violations: collectViolations(validationErr.BasicOutput())}
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func collectViolations(output *jsonschema.OutputUnit) []SchemaViolation {
+	violations := make([]SchemaViolation, 0, len(output.Errors))
+
+	for _, unit := range output.Errors {
+		if unit.Error != nil {
+			violations = append(violations, SchemaViolation{Path: unit.InstanceLocation, Message: unit.Error.String()})
+		}
+	}
+
+	if len(violations) == 0 && output.Error != nil {
+		violations = append(violations, SchemaViolation{Path: output.InstanceLocation, Message: output.Error.String()})
+	}
+
+	return violations
+}
+
+// compileSchema returns the compiled schema, it's compiled again once the stored schema changed.
+func compileSchema(schema *Schema) (*compiledSchema, error) {
+	compiledSchemasMutex.Lock()
+	defer compiledSchemasMutex.Unlock()
+
+	if compiled := compiledSchemas[schema.Name]; compiled != nil && compiled.hash == schema.hash {
+		return compiled, nil
+	}
+
+	compiled, err := newCompiledSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	compiledSchemas[schema.Name] = compiled
+	return compiled, nil
+}
+
+// newCompiledSchema compiles the pattern and the JSON Schema of schema, which may not reference any external resources.
+func newCompiledSchema(schema *Schema) (*compiledSchema, error) {
+	compiled := &compiledSchema{hash: schema.hash, key: schema.Key}
+
+	// The pattern has to be valid on its own to not escape the anchors
+	if schema.Pattern != "" {
+		if _, err := regexp.Compile(schema.Pattern); err != nil {
+			return nil, err
+		} else if compiled.pattern, err = regexp.Compile("^(?:" + schema.Pattern + ")$"); err != nil {
+			return nil, err
+		}
+	}
+
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(schema.Schema))
+	if err != nil {
+		return nil, err
+	}
+
+	compiler := jsonschema.NewCompiler()
+	compiler.DefaultDraft(jsonschema.Draft2020)
+	compiler.UseLoader(noSchemaLoader{})
+
+	if err := compiler.AddResource("schema.json", doc); err != nil {
+		return nil, err
+	} else if compiled.schema, err = compiler.Compile("schema.json"); err != nil {
+		return nil, err
+	}
+
+	return compiled, nil
+}
+
+type noSchemaLoader struct{}
+
+func (noSchemaLoader) Load(url string) (any, error) {
+	return nil, fmt.Errorf("loading external schema %s is not allowed", url)
+}
+
+func buildSchemaKey(name string) []byte {
+	return []byte(dbSchemaPrefix + dbKeySeparator + name)
+}
@@ -0,0 +1,44 @@
+package core
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchemaCache(t *testing.T) {
+	useTestStore(t, dbBackendMemory)
+	t.Cleanup(func() { _ = DeleteSchema("numbers") })
+
+	validate := func(key, value string) error {
+		return db().View(func(txn Txn) error {
+			return validateData(txn, key, []byte(value))
+		})
+	}
+
+	assert.NoError(t, SetSchema(Schema{Name: "numbers", Pattern: "n[0-9]+", Schema: json.RawMessage(`{"type": "number"}`)}))
+	assert.Error(t, validate("n1", `"a"`))
+	assert.NoError(t, validate("n1", `1`))
+	assert.NoError(t, validate("x1", `"a"`))
+
+	// Replacing a schema replaces its compiled version
+	assert.NoError(t, SetSchema(Schema{Name: "numbers", Pattern: "x[0-9]+", Schema: json.RawMessage(`{"type": "string"}`)}))
+	assert.NoError(t, validate("n1", `"a"`))
+	assert.Error(t, validate("x1", `1`))
+	assert.Len(t, compiledSchemas, 1)
+
+	// Schemas changed behind its back are compiled again
+	assert.NoError(t, db().Update(func(txn Txn) error {
+		return txn.Set(buildSchemaKey("numbers"), []byte(`{"name": "numbers", "key": "k", "schema": {"type": "boolean"}}`))
+	}))
+	assert.NoError(t, validate("x1", `1`))
+	assert.Error(t, validate("k", `1`))
+
+	assert.NoError(t, DeleteSchema("numbers"))
+	assert.Empty(t, compiledSchemas)
+	assert.NoError(t, validate("k", `1`))
+
+	// Patterns can't escape their anchors
+	assert.ErrorIs(t, SetSchema(Schema{Name: "any", Pattern: "a)|(.*", Schema: json.RawMessage(`{}`)}), ErrInvalidSchema)
+}
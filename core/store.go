@@ -0,0 +1,127 @@
+package core
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// The database is kept in a transactional, ordered key-value store. Everything in core is built on
+// top of the Store interface. Badger is used by default, a single-file bbolt database for GENESIS_DB_PATH=bolt:<path>
+// and an in-memory store for GENESIS_DB_PATH=:memory:.
+
+const dbMemoryPath = ":memory:"
+
+const (
+	dbBackendBadger = "badger"
+	dbBackendBolt   = "bolt"
+	dbBackendMemory = "memory"
+)
+
+var (
+	ErrKeyNotFound = errors.New("key not found")
+	ErrConflict    = errors.New("transaction conflicted with a concurrent one")
+	ErrTxnTooBig   = errors.New("transaction has too many writes")
+)
+
+type Store interface {
+
+	// NewTransaction starts a transaction, it has to be discarded or committed.
+	NewTransaction(update bool) Txn
+
+	// View runs fn in a read-only transaction.
+	View(fn func(txn Txn) error) error
+
+	// Update runs fn in a read-write transaction which is committed if fn succeeds,
+	// returns ErrConflict if it conflicted with a concurrent one.
+	Update(fn func(txn Txn) error) error
+
+	// DropAll removes all keys.
+	DropAll() error
+
+	// Backup writes all keys changed after the given version in badger's backup format and returns the version
+	// of the latest one, backends without versions write all keys and return zero.
+	Backup(w io.Writer, since uint64) (uint64, error)
+
+	// Load writes the keys of a backup, no other transactions may run meanwhile.
+	Load(r io.Reader) error
+
+	Close() error
+}
+
+// Txn sees a consistent snapshot of the store and its own writes.
+type Txn interface {
+
+	// Get returns ErrKeyNotFound if key doesn't exist or expired.
+	Get(key []byte) (Item, error)
+
+	Set(key, value []byte) error
+
+	// SetEntry sets a value which vanishes on its own at expiresAt, or never if it's zero.
+	SetEntry(key, value []byte, expiresAt time.Time) error
+
+	Delete(key []byte) error
+
+	// NewIterator iterates over all keys in ascending order, it has to be closed.
+	NewIterator(opts IteratorOptions) Iterator
+
+	Commit() error
+	Discard()
+}
+
+// Item is a key and its value, it's only valid until the next call of the iterator or the end of the transaction.
+type Item interface {
+	Key() []byte
+	KeyCopy(dst []byte) []byte
+	Value(fn func(val []byte) error) error
+	ValueCopy(dst []byte) ([]byte, error)
+	ExpiresAt() time.Time // Zero if it doesn't expire
+}
+
+type Iterator interface {
+	Rewind()
+	Seek(key []byte)
+	Valid() bool
+	ValidForPrefix(prefix []byte) bool
+	Next()
+	Item() Item
+	Close()
+}
+
+type IteratorOptions struct {
+
+	// PrefetchValues may be disabled if only keys are used.
+	PrefetchValues bool
+}
+
+var DefaultIteratorOptions = IteratorOptions{PrefetchValues: true}
+
+// parseStoreLocation splits a location like bolt:<path> into its backend and absolute path,
+// locations without a known backend are paths of a badger database.
+func parseStoreLocation(location string) (string, string) {
+	if location == dbMemoryPath {
+		return dbBackendMemory, location
+	} else if backend, path, ok := strings.Cut(location, ":"); ok && (backend == dbBackendBadger || backend == dbBackendBolt) {
+		return backend, resolvePath(path)
+	}
+
+	return dbBackendBadger, resolvePath(location)
+}
+
+// openStore opens the store of backend at path.
+func openStore(backend, path string, encryptionKey []byte) (Store, error) {
+	switch backend {
+	case dbBackendMemory:
+		return newMemoryStore(), nil
+	case dbBackendBolt:
+		return openBolt(path, encryptionKey)
+	}
+
+	db, err := openBadger(path, encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return newBadgerStore(db), nil
+}
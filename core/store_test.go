@@ -0,0 +1,204 @@
+package core
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.etcd.io/bbolt"
+)
+
+var testBackends = []string{dbBackendBadger, dbBackendBolt, dbBackendMemory}
+
+// openTestStore opens an empty store of backend in a temporary directory which is closed after the test.
+func openTestStore(t *testing.T, backend string) Store {
+	path := filepath.Join(t.TempDir(), "db")
+	store, err := openStore(backend, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { _ = store.Close() })
+	return store
+}
+
+// useTestStore replaces the database with an empty store of backend for the duration of the test.
+func useTestStore(t *testing.T, backend string) Store {
+	previous := db()
+	store := openTestStore(t, backend)
+
+	database = store
+	t.Cleanup(func() { database = previous })
+	return store
+}
+
+func collectKeys(t *testing.T, store Store, prefix string) []string {
+	keys := make([]string, 0)
+
+	assert.NoError(t, store.View(func(txn Txn) error {
+		it := txn.NewIterator(DefaultIteratorOptions)
+		defer it.Close()
+
+		for it.Seek([]byte(prefix)); it.ValidForPrefix([]byte(prefix)); it.Next() {
+			keys = append(keys, string(it.Item().Key()))
+		}
+
+		return nil
+	}))
+
+	return keys
+}
+
+func TestStoreExpiration(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend, func(t *testing.T) {
+			store := openTestStore(t, backend)
+			expiresAt := time.Now().Add(time.Hour)
+
+			assert.NoError(t, store.Update(func(txn Txn) error {
+				return errors.Join(
+					txn.SetEntry([]byte("k/expired"), []byte("a"), time.Now().Add(-time.Second)),
+					txn.SetEntry([]byte("k/expiring"), []byte("b"), expiresAt),
+					txn.Set([]byte("k/kept"), []byte("c")),
+				)
+			}))
+
+			assert.NoError(t, store.View(func(txn Txn) error {
+				_, err := txn.Get([]byte("k/expired"))
+				assert.ErrorIs(t, err, ErrKeyNotFound)
+
+				item, err := txn.Get([]byte("k/expiring"))
+				if assert.NoError(t, err) {
+					assert.Equal(t, expiresAt.Unix(), item.ExpiresAt().Unix())
+				}
+
+				item, err = txn.Get([]byte("k/kept"))
+				if assert.NoError(t, err) {
+					assert.True(t, item.ExpiresAt().IsZero())
+				}
+
+				return nil
+			}))
+
+			assert.Equal(t, []string{"k/expiring", "k/kept"}, collectKeys(t, store, "k/"))
+		})
+	}
+}
+
+func TestStoreChangesWhileIterating(t *testing.T) {
+	for _, backend := range testBackends {
+		t.Run(backend, func(t *testing.T) {
+			store := openTestStore(t, backend)
+
+			assert.NoError(t, store.Update(func(txn Txn) error {
+				for _, key := range []string{"a/1", "a/2", "a/3", "a/4", "b/1"} {
+					if err := txn.Set([]byte(key), []byte(key)); err != nil {
+						return err
+					}
+				}
+
+				return nil
+			}))
+
+			// Every key is visited once even if it's deleted or others are added meanwhile
+			visited := make([]string, 0)
+			assert.NoError(t, store.Update(func(txn Txn) error {
+				it := txn.NewIterator(DefaultIteratorOptions)
+				defer it.Close()
+
+				for it.Seek([]byte("a/")); it.ValidForPrefix([]byte("a/")); it.Next() {
+					key := it.Item().KeyCopy(nil)
+					visited = append(visited, string(key))
+
+					if err := txn.Delete(key); err != nil {
+						return err
+					} else if err := txn.Set(append([]byte("c/"), key...), key); err != nil {
+						return err
+					}
+				}
+
+				return nil
+			}))
+
+			assert.Equal(t, []string{"a/1", "a/2", "a/3", "a/4"}, visited)
+			assert.Empty(t, collectKeys(t, store, "a/"))
+			assert.Equal(t, []string{"b/1"}, collectKeys(t, store, "b/"))
+			assert.Len(t, collectKeys(t, store, "c/"), 4)
+		})
+	}
+}
+
+func TestBoltSweep(t *testing.T) {
+	store := openTestStore(t, dbBackendBolt).(*boltStore)
+
+	assert.NoError(t, store.Update(func(txn Txn) error {
+		for _, key := range []string{"k/1", "k/2", "k/3"} {
+			if err := txn.SetEntry([]byte(key), []byte(key), time.Now().Add(-time.Second)); err != nil {
+				return err
+			}
+		}
+
+		return txn.SetEntry([]byte("k/4"), []byte("k/4"), time.Now().Add(time.Hour))
+	}))
+
+	assert.NoError(t, store.sweep())
+
+	// Expired values are gone from the file, not only skipped
+	stored := 0
+	assert.NoError(t, store.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltBucket).ForEach(func(_, _ []byte) error {
+			stored++
+			return nil
+		})
+	}))
+
+	assert.Equal(t, 1, stored)
+	assert.Equal(t, []string{"k/4"}, collectKeys(t, store, "k/"))
+}
+
+func TestBoltClosed(t *testing.T) {
+	store, err := openStore(dbBackendBolt, filepath.Join(t.TempDir(), "db"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, store.Close())
+
+	// Transactions which can't be started return the error instead of exiting
+	txn := store.NewTransaction(true)
+	defer txn.Discard()
+
+	_, err = txn.Get([]byte("k"))
+	assert.ErrorIs(t, err, bbolt.ErrDatabaseNotOpen)
+	assert.ErrorIs(t, txn.Set([]byte("k"), []byte("v")), bbolt.ErrDatabaseNotOpen)
+	assert.ErrorIs(t, txn.Commit(), bbolt.ErrDatabaseNotOpen)
+
+	it := txn.NewIterator(DefaultIteratorOptions)
+	it.Rewind()
+	assert.False(t, it.Valid())
+	it.Close()
+}
+
+func TestUpdateRetries(t *testing.T) {
+	useTestStore(t, dbBackendMemory)
+
+	attempts := 0
+	assert.NoError(t, update(func(txn Txn) error {
+		if attempts++; attempts < 3 {
+			return ErrConflict
+		}
+
+		return nil
+	}))
+	assert.Equal(t, 3, attempts)
+
+	// Gives up once all attempts conflicted
+	attempts = 0
+	assert.ErrorIs(t, update(func(txn Txn) error {
+		attempts++
+		return ErrConflict
+	}), ErrConflict)
+	assert.Equal(t, dbUpdateAttempts, attempts)
+}
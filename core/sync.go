@@ -0,0 +1,196 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Each write of a user gets the next number of its sequence, deleted keys are kept as tombstones
+// with the sequence of their deletion for a while. Cursors consist of a sequence and the time they
+// were issued, a cursor older than the tombstone retention may have missed deletions.
+
+// tombstoneGrace keeps tombstones a bit longer than cursors are valid to cover deletions
+// committed while a cursor is issued.
+const tombstoneGrace = time.Minute
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrCursorExpired = errors.New("cursor expired, a full resync is required")
+)
+
+type Changes struct {
+	Changed map[string]json.RawMessage `json:"changed"`
+	Deleted []string                   `json:"deleted"`
+	Cursor  string                     `json:"cursor"`
+}
+
+// GetChangesForUser returns all values changed and keys deleted since the given cursor,
+// an empty cursor returns all values.
+func GetChangesForUser(name, cursor string) (*Changes, error) {
+	now := time.Now()
+	txn := db().NewTransaction(false)
+	defer txn.Discard()
+
+	since, issued, err := parseCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	sequence, err := getSequence(txn, name)
+	if err != nil {
+		return nil, err
+	} else if since > sequence || (since > 0 && now.Sub(issued) > Config.AppTombstoneRetention) {
+		return nil, ErrCursorExpired
+	}
+
+	changes := &Changes{
+		Changed: make(map[string]json.RawMessage),
+		Deleted: make([]string, 0),
+		Cursor:  fmt.Sprintf("%d-%d", sequence, now.Unix()),
+	}
+
+	if err := collectChanged(txn, name, since, changes); err != nil {
+		return nil, err
+	} else if since == 0 {
+		return changes, nil
+	} else if err := collectDeleted(txn, name, since, issued, changes); err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+func collectChanged(txn Txn, name string, since uint64, changes *Changes) error {
+	it := txn.NewIterator(DefaultIteratorOptions)
+	defer it.Close()
+
+	prefix := buildUserDataKey(name, "")
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		key := string(it.Item().Key()[len(prefix):])
+
+		if meta, err := getMeta(txn, name, key); err != nil {
+			return err
+		} else if meta == nil || (since > 0 && meta.Sequence <= since) {
+			continue
+		}
+
+		value, err := readValue(it.Item())
+		if err != nil {
+			return err
+		}
+
+		changes.Changed[key] = value
+	}
+
+	return nil
+}
+
+func collectDeleted(txn Txn, name string, since uint64, issued time.Time, changes *Changes) error {
+	it := txn.NewIterator(DefaultIteratorOptions)
+	defer it.Close()
+
+	prefix := buildTombstoneKey(name, "")
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		var sequence uint64
+
+		if err := it.Item().Value(func(val []byte) (err error) {
+			sequence, err = strconv.ParseUint(string(val), 10, 64)
+			return err
+		}); err != nil {
+			return err
+		} else if sequence > since {
+			changes.Deleted = append(changes.Deleted, string(it.Item().Key()[len(prefix):]))
+		}
+	}
+
+	// Expired values get their tombstone once the expiration is settled, those which expired
+	// before the cursor was issued have been reported already
+	expired, err := expiredKeys(txn, name, issued)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range expired {
+		if _, ok := changes.Changed[key]; !ok && !slices.Contains(changes.Deleted, key) {
+			changes.Deleted = append(changes.Deleted, key)
+		}
+	}
+
+	return nil
+}
+
+// nextSequence increments and returns the sequence of a user, the caller must hold the lock of the user.
+func nextSequence(txn Txn, name string) (uint64, error) {
+	sequence, err := getSequence(txn, name)
+	if err != nil {
+		return 0, err
+	}
+
+	sequence++
+	return sequence, txn.Set(buildSequenceKey(name), []byte(strconv.FormatUint(sequence, 10)))
+}
+
+func getSequence(txn Txn, name string) (uint64, error) {
+	item, err := txn.Get(buildSequenceKey(name))
+	if errors.Is(err, ErrKeyNotFound) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	var sequence uint64
+	return sequence, item.Value(func(val []byte) (err error) {
+		sequence, err = strconv.ParseUint(string(val), 10, 64)
+		return err
+	})
+}
+
+func addTombstone(txn Txn, name, key string) error {
+	sequence, err := nextSequence(txn, name)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(Config.AppTombstoneRetention + tombstoneGrace)
+	return txn.SetEntry(buildTombstoneKey(name, key), []byte(strconv.FormatUint(sequence, 10)), expiresAt)
+}
+
+func removeTombstone(txn Txn, name, key string) error {
+	return txn.Delete(buildTombstoneKey(name, key))
+}
+
+func parseCursor(cursor string) (uint64, time.Time, error) {
+	if cursor == "" {
+		return 0, time.Time{}, nil
+	}
+
+	sequence, issued, ok := strings.Cut(cursor, "-")
+	if !ok {
+		return 0, time.Time{}, ErrInvalidCursor
+	}
+
+	parsedSequence, err := strconv.ParseUint(sequence, 10, 64)
+	if err != nil {
+		return 0, time.Time{}, ErrInvalidCursor
+	}
+
+	parsedIssued, err := strconv.ParseInt(issued, 10, 64)
+	if err != nil {
+		return 0, time.Time{}, ErrInvalidCursor
+	}
+
+	return parsedSequence, time.Unix(parsedIssued, 0), nil
+}
+
+func buildSequenceKey(name string) []byte {
+	return []byte(dbSequencePrefix + dbKeySeparator + name)
+}
+
+func buildTombstoneKey(name, key string) []byte {
+	return []byte(dbTombstonePrefix + dbKeySeparator + name + dbKeySeparator + key)
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrentSequence(t *testing.T) {
+	useTestStore(t, dbBackendBadger)
+
+	for i := 0; i < 20; i++ {
+		_, err := SetDataForUser("foo", "d"+strconv.Itoa(i), []byte("1"), WriteOptions{})
+		assert.NoError(t, err)
+	}
+
+	// Sets, deletes and their tombstones all take the next number of the sequence
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := SetDataForUser("foo", "s"+strconv.Itoa(i), []byte("1"), WriteOptions{})
+			assert.NoError(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, DeleteDataFromUser("foo", "d"+strconv.Itoa(i), WriteOptions{SkipTrash: true}))
+		}()
+	}
+
+	wg.Wait()
+
+	assert.NoError(t, db().View(func(txn Txn) error {
+		sequence, err := getSequence(txn, "foo")
+		assert.Equal(t, uint64(60), sequence)
+		return err
+	}))
+}
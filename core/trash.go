@@ -0,0 +1,291 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Deleted values are moved into the trash of their user, they don't count towards the key limit
+// or quota and are purged by a background job once the trash retention passed. The oldest ones are
+// purged early if the trash of a user exceeds its size budget.
+
+const trashPurgeInterval = time.Hour
+
+var ErrKeyExists = errors.New("key already exists")
+
+// TrashedData describes a deleted value in the trash of a user.
+type TrashedData struct {
+	Key      string    `json:"key"`
+	Revision uint64    `json:"revision"` // Revision at the time it was deleted
+	Size     int64     `json:"size"`
+	Deleted  time.Time `json:"deleted"`
+	Purge    time.Time `json:"purge"` // Time it's removed for good
+}
+
+// GetTrashForUser returns all values in the trash of a user ordered by key.
+func GetTrashForUser(name string) ([]*TrashedData, error) {
+	txn := db().NewTransaction(false)
+	defer txn.Discard()
+
+	it := txn.NewIterator(DefaultIteratorOptions)
+	defer it.Close()
+
+	now := time.Now()
+	prefix := buildTrashKey(dbTrashPrefix, name, "")
+	list := make([]*TrashedData, 0)
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		trashed := &TrashedData{}
+
+		if err := it.Item().Value(func(val []byte) error {
+			return json.Unmarshal(val, trashed)
+		}); err != nil {
+			return nil, err
+		} else if trashed.Purge.After(now) {
+			list = append(list, trashed)
+		}
+	}
+
+	return list, nil
+}
+
+// RestoreTrashedData moves a value from the trash back to key, which must not exist.
+// Returns ErrKeyNotFound if it's not in the trash.
+func RestoreTrashedData(name, key string, opts WriteOptions) (*DataMeta, error) {
+	unlock := lockUser(name)
+	defer unlock()
+
+	var meta *DataMeta
+	var data []byte
+
+	err := update(func(txn Txn) (err error) {
+		if data, err = getTrashedValue(txn, name, key); err != nil {
+			return err
+		} else if current, err := getMeta(txn, name, key); err != nil {
+			return err
+		} else if current != nil {
+			return ErrKeyExists
+		} else if meta, err = setData(txn, name, key, data, opts); err != nil {
+			return err
+		} else if countKeys(txn, name) > Config.AppKeysPerUser {
+			return ErrTooManyKeys
+		}
+
+		return removeTrash(txn, name, key)
+	})
+
+	if err == nil {
+		publishSet(name, key, meta, data)
+	}
+
+	return meta, err
+}
+
+// PurgeTrashedData removes a value from the trash for good.
+// Returns ErrKeyNotFound if it's not in the trash.
+func PurgeTrashedData(name, key string) error {
+	return updateUser(name, func(txn Txn) error {
+		if _, err := getLiveTrashed(txn, name, key); err != nil {
+			return err
+		}
+
+		return removeTrash(txn, name, key)
+	})
+}
+
+// purgeTrash removes all values from the trash whose retention passed.
+func purgeTrash() error {
+	now := time.Now()
+	expired, err := listExpiredTrash(now)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range expired {
+		name, key, _ := strings.Cut(id, dbKeySeparator)
+
+		// The value may have been restored or deleted again in the meantime
+		if err := updateUser(name, func(txn Txn) error {
+			if trashed, err := getTrashed(txn, name, key); errors.Is(err, ErrKeyNotFound) {
+				return nil
+			} else if err != nil {
+				return err
+			} else if trashed.Purge.After(now) {
+				return nil
+			}
+
+			return removeTrash(txn, name, key)
+		}); err != nil {
+			return err
+		}
+	}
+
+	if len(expired) > 0 {
+		Logger.Debug("purged trash", zap.Int("count", len(expired)))
+	}
+
+	return nil
+}
+
+// listExpiredTrash returns the <user>/<key> ids of all values in the trash whose retention passed at now.
+// The read transaction is discarded before they're removed, writes may have to wait for it otherwise.
+func listExpiredTrash(now time.Time) ([]string, error) {
+	txn := db().NewTransaction(false)
+	defer txn.Discard()
+
+	it := txn.NewIterator(DefaultIteratorOptions)
+	defer it.Close()
+
+	prefix := []byte(dbTrashPrefix + dbKeySeparator)
+	expired := make([]string, 0)
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		var trashed TrashedData
+
+		if err := it.Item().Value(func(val []byte) error {
+			return json.Unmarshal(val, &trashed)
+		}); err != nil {
+			return nil, err
+		} else if !trashed.Purge.After(now) {
+			expired = append(expired, string(it.Item().Key()[len(prefix):]))
+		}
+	}
+
+	return expired, nil
+}
+
+// trashData moves the value of a deleted key into the trash, replacing a previously deleted one.
+// Values are deleted right away if the trash retention is zero.
+func trashData(txn Txn, name, key string, meta *DataMeta) error {
+	if Config.AppTrashRetention <= 0 {
+		return nil
+	}
+
+	item, err := txn.Get(buildUserDataKey(name, key))
+	if err != nil {
+		return err
+	}
+
+	value, err := item.ValueCopy(nil) // Kept encoded as it is
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	encoded, err := json.Marshal(TrashedData{
+		Key:      key,
+		Revision: meta.Revision,
+		Size:     meta.Size,
+		Deleted:  now,
+		Purge:    now.Add(Config.AppTrashRetention),
+	})
+
+	if err != nil {
+		return err
+	} else if err := txn.Set(buildTrashKey(dbTrashValuePrefix, name, key), value); err != nil {
+		return err
+	} else if err := txn.Set(buildTrashKey(dbTrashPrefix, name, key), encoded); err != nil {
+		return err
+	}
+
+	return trimTrash(txn, name)
+}
+
+// trimTrash removes the oldest values from the trash of a user until it fits into its size budget.
+func trimTrash(txn Txn, name string) error {
+	it := txn.NewIterator(DefaultIteratorOptions)
+	prefix := buildTrashKey(dbTrashPrefix, name, "")
+	list := make([]TrashedData, 0)
+	size := int64(0)
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		var trashed TrashedData
+
+		if err := it.Item().Value(func(val []byte) error {
+			return json.Unmarshal(val, &trashed)
+		}); err != nil {
+			it.Close()
+			return err
+		}
+
+		list = append(list, trashed)
+		size += trashed.Size
+	}
+
+	it.Close()
+
+	slices.SortStableFunc(list, func(a, b TrashedData) int {
+		return a.Deleted.Compare(b.Deleted)
+	})
+
+	for _, trashed := range list {
+		if size <= Config.AppTrashMaxSize {
+			break
+		} else if err := removeTrash(txn, name, trashed.Key); err != nil {
+			return err
+		}
+
+		size -= trashed.Size
+	}
+
+	return nil
+}
+
+func removeTrash(txn Txn, name, key string) error {
+	if err := txn.Delete(buildTrashKey(dbTrashPrefix, name, key)); err != nil {
+		return err
+	}
+
+	return txn.Delete(buildTrashKey(dbTrashValuePrefix, name, key))
+}
+
+func getTrashed(txn Txn, name, key string) (*TrashedData, error) {
+	item, err := txn.Get(buildTrashKey(dbTrashPrefix, name, key))
+	if err != nil {
+		return nil, err
+	}
+
+	trashed := &TrashedData{}
+	if err := item.Value(func(val []byte) error {
+		return json.Unmarshal(val, trashed)
+	}); err != nil {
+		return nil, err
+	}
+
+	return trashed, nil
+}
+
+// getLiveTrashed is like getTrashed but ignores values waiting to be purged.
+func getLiveTrashed(txn Txn, name, key string) (*TrashedData, error) {
+	trashed, err := getTrashed(txn, name, key)
+	if err != nil {
+		return nil, err
+	} else if !trashed.Purge.After(time.Now()) {
+		return nil, ErrKeyNotFound
+	}
+
+	return trashed, nil
+}
+
+func getTrashedValue(txn Txn, name, key string) ([]byte, error) {
+	if _, err := getLiveTrashed(txn, name, key); err != nil {
+		return nil, err
+	}
+
+	item, err := txn.Get(buildTrashKey(dbTrashValuePrefix, name, key))
+	if err != nil {
+		return nil, err
+	}
+
+	return readValue(item)
+}
+
+// buildTrashKey returns the key of a trashed value, or the prefix of all of them if key is empty.
+func buildTrashKey(prefix, name, key string) []byte {
+	return []byte(prefix + dbKeySeparator + name + dbKeySeparator + key)
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Values with an expiration vanish on their own, their sizes are kept in an index ordered by
+// expiration to account for them in the usage of their user once they're gone.
+
+func addExpiration(txn Txn, name, key string, meta *DataMeta) error {
+	if meta.Expires.IsZero() {
+		return nil
+	}
+
+	return txn.Set(buildExpirationKey(name, meta.Expires, key), []byte(strconv.FormatInt(meta.Size, 10)))
+}
+
+func removeExpiration(txn Txn, name, key string, meta *DataMeta) error {
+	if meta == nil || meta.Expires.IsZero() {
+		return nil
+	}
+
+	return txn.Delete(buildExpirationKey(name, meta.Expires, key))
+}
+
+// expiredUsage returns the size of all expired values of a user which is still part of the stored usage.
+// If settle is true, they're removed from the index and replaced by a tombstone, along with their remaining history.
+func expiredUsage(txn Txn, name string, settle bool) (int64, error) {
+	freed := int64(0)
+
+	err := iterateExpired(txn, name, func(key string, _ time.Time, size int64, indexKey []byte) error {
+		freed += size
+
+		if !settle {
+			return nil
+		} else if err := txn.Delete(indexKey); err != nil {
+			return err
+		} else if current, err := getMeta(txn, name, key); err != nil || current != nil {
+			return err
+		} else if err := addTombstone(txn, name, key); err != nil {
+			return err
+		}
+
+		return deleteHistory(txn, name, key)
+	})
+
+	return freed, err
+}
+
+// expiredKeys returns the keys of all values of a user which expired after the given time and haven't been settled yet.
+func expiredKeys(txn Txn, name string, after time.Time) ([]string, error) {
+	var keys []string
+
+	err := iterateExpired(txn, name, func(key string, expires time.Time, _ int64, _ []byte) error {
+		if !expires.After(after) {
+			return nil
+		} else if current, err := getMeta(txn, name, key); err != nil || current != nil {
+			return err
+		}
+
+		keys = append(keys, key)
+		return nil
+	})
+
+	return keys, err
+}
+
+func iterateExpired(txn Txn, name string, fn func(key string, expires time.Time, size int64, indexKey []byte) error) error {
+	it := txn.NewIterator(DefaultIteratorOptions)
+	defer it.Close()
+
+	prefix := buildExpirationPrefix(name)
+	now := time.Now().Unix()
+
+	for it.Seek(prefix); it.ValidForPrefix(prefix); it.Next() {
+		item := it.Item()
+		path := string(item.Key()[len(prefix):])
+
+		// Badger considers values expired within the second of their expiration
+		expires, err := strconv.ParseInt(path[:20], 10, 64)
+		if err != nil {
+			return err
+		} else if expires > now {
+			break
+		}
+
+		var size int64
+		if err := item.Value(func(val []byte) (err error) {
+			size, err = strconv.ParseInt(string(val), 10, 64)
+			return err
+		}); err != nil {
+			return err
+		} else if err := fn(path[21:], time.Unix(expires, 0), size, item.KeyCopy(nil)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func buildExpirationKey(name string, expires time.Time, key string) []byte {
+	return append(buildExpirationPrefix(name), fmt.Sprintf("%020d%s%s", expires.Unix(), dbKeySeparator, key)...)
+}
+
+func buildExpirationPrefix(name string) []byte {
+	return []byte(dbExpirationPrefix + dbKeySeparator + name + dbKeySeparator)
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"errors"
+	"strconv"
+)
+
+var ErrQuotaExceeded = errors.New("storage quota exceeded")
+
+type Usage struct {
+	Bytes int64
+	Keys  int64
+}
+
+func GetUsageForUser(name string) (*Usage, error) {
+	txn := db().NewTransaction(false)
+	defer txn.Discard()
+
+	bytes, err := getUsage(txn, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Usage{Bytes: bytes, Keys: countKeys(txn, name)}, nil
+}
+
+// adjustUsage adds delta to the bytes stored by a user, it must be called before the value is written.
+// ErrQuotaExceeded is returned if the usage grows beyond the quota. Writes must hold the lock of the user,
+// see lockUser, concurrent ones would conflict on the usage otherwise.
+func adjustUsage(txn Txn, name string, delta int64) error {
+	used, err := getStoredUsage(txn, name)
+	if err != nil {
+		return err
+	}
+
+	expired, err := expiredUsage(txn, name, true)
+	if err != nil {
+		return err
+	}
+
+	used -= expired
+	if delta > 0 && Config.AppQuotaPerUser > 0 && used+delta > Config.AppQuotaPerUser {
+		return ErrQuotaExceeded
+	}
+
+	return txn.Set(buildUsageKey(name), []byte(strconv.FormatInt(used+delta, 10)))
+}
+
+func getUsage(txn Txn, name string) (int64, error) {
+	used, err := getStoredUsage(txn, name)
+	if err != nil {
+		return 0, err
+	}
+
+	expired, err := expiredUsage(txn, name, false)
+	return used - expired, err
+}
+
+// getStoredUsage returns the bytes stored by a user including expired values, it's computed
+// once for data stored before it was tracked.
+func getStoredUsage(txn Txn, name string) (int64, error) {
+	item, err := txn.Get(buildUsageKey(name))
+
+	if errors.Is(err, ErrKeyNotFound) {
+		meta, err := getAllMeta(txn, name)
+		if err != nil {
+			return 0, err
+		}
+
+		used := int64(0)
+		for _, m := range meta {
+			used += m.Size
+		}
+
+		return used, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	var used int64
+	return used, item.Value(func(val []byte) (err error) {
+		used, err = strconv.ParseInt(string(val), 10, 64)
+		return err
+	})
+}
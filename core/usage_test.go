@@ -0,0 +1,35 @@
+package core
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrentWrites(t *testing.T) {
+	useTestStore(t, dbBackendBadger)
+
+	// Writes of the same user to different keys all touch its usage
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := SetDataForUser("foo", "k"+strconv.Itoa(i), []byte(`{"a":1}`), WriteOptions{})
+			assert.NoError(t, err)
+		}()
+	}
+
+	wg.Wait()
+
+	usage, err := GetUsageForUser("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, Usage{Bytes: 40 * 7, Keys: 40}, *usage)
+
+	// Locks are removed once they're released
+	userLocksMutex.Lock()
+	defer userLocksMutex.Unlock()
+	assert.Empty(t, userLocks)
+}
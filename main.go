@@ -59,6 +59,112 @@ func main() {
 					},
 				},
 			},
+			{
+				Name:  "schemas",
+				Usage: "Manage JSON schemas for data",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "ls",
+						Aliases:   []string{"list"},
+						Usage:     "Lists all schemas",
+						UsageText: "genesis schemas ls",
+						Action:    commands.ListSchemas,
+					},
+					{
+						Name:      "set",
+						Usage:     "Creates or replaces a schema for a key or all keys matching a pattern",
+						UsageText: "genesis schemas set [flags] [name] [file]",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "key",
+								Usage: "Name of the key to validate",
+							},
+							&cli.StringFlag{
+								Name:  "pattern",
+								Usage: "Regular expression matching the keys to validate",
+							},
+						},
+						Action: commands.SetSchema,
+					},
+					{
+						Name:      "rm",
+						Aliases:   []string{"remove"},
+						Usage:     "Removes a schema",
+						UsageText: "genesis schemas rm [name]",
+						Action:    commands.RemoveSchema,
+					},
+				},
+			},
+			{
+				Name:  "db",
+				Usage: "Maintain the database",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "recompress",
+						Usage:     "Compresses or decompresses all stored values according to GENESIS_COMPRESSION_MIN_SIZE",
+						UsageText: "genesis db recompress",
+						Action:    commands.RecompressDatabase,
+					},
+					{
+						Name:      "rotate-key",
+						Usage:     "Re-encrypts the data keys with a new encryption key, the server must be stopped",
+						UsageText: "genesis db rotate-key [flags]",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "new-key",
+								Usage: "The new encryption key, 16, 24 or 32 bytes long",
+							},
+							&cli.StringFlag{
+								Name:  "new-key-file",
+								Usage: "File containing the new encryption key",
+							},
+						},
+						Action: commands.RotateEncryptionKey,
+					},
+					{
+						Name:      "encrypt",
+						Usage:     "Encrypts an existing plaintext database with GENESIS_DB_ENCRYPTION_KEY, the server must be stopped",
+						UsageText: "genesis db encrypt",
+						Action:    commands.EncryptDatabase,
+					},
+					{
+						Name:      "migrate",
+						Usage:     "Copies all keys into a new database of another backend and verifies them, the server must be stopped",
+						UsageText: "genesis db migrate --from badger:[path] --to bolt:[path]",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "from",
+								Usage:    "Location of the source database, e.g. badger:.data",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "to",
+								Usage:    "Location of the new database, e.g. bolt:.data/genesis.db",
+								Required: true,
+							},
+						},
+						Action: commands.MigrateDatabase,
+					},
+					{
+						Name:      "backup",
+						Usage:     "Writes a backup of the database to a file, the server must be stopped, use GET /admin/backup otherwise",
+						UsageText: "genesis db backup [file]",
+						Action:    commands.BackupDatabase,
+					},
+					{
+						Name:      "restore",
+						Usage:     "Restores an empty database from a full backup followed by incremental ones, the server must be stopped",
+						UsageText: "genesis db restore [file] [incremental files...] or genesis db restore --from s3://[bucket]/[key]",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "from",
+								Usage: "Restores the chain of backups ending with the given object, or the latest one if it's a prefix",
+							},
+						},
+						Action: commands.RestoreDatabase,
+					},
+				},
+			},
 		},
 	}
 
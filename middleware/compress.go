@@ -0,0 +1,177 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+// compressMinSize is the size responses need to reach to be compressed.
+const compressMinSize = 1024
+
+// Compress compresses responses with brotli or gzip, depending on the Accept-Encoding of the request.
+func Compress() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		writer := &compressWriter{ResponseWriter: c.Writer, encoding: encoding}
+		c.Writer = writer
+		c.Writer.Header().Add("Vary", "Accept-Encoding")
+
+		defer writer.close()
+		c.Next()
+	}
+}
+
+// DecompressBody decompresses request bodies sent with a gzip Content-Encoding, it has to come
+// before LimitBodySize to limit the decompressed size.
+func DecompressBody() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.GetHeader("Content-Encoding") {
+		case "", "identity":
+		case "gzip":
+			reader, err := gzip.NewReader(c.Request.Body)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "invalid gzip body"})
+				return
+			}
+
+			c.Request.Body = reader
+			c.Request.ContentLength = -1
+			c.Request.Header.Set("Content-Length", "-1")
+			c.Request.Header.Del("Content-Encoding")
+		default:
+			c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{"error": "content encoding must be gzip"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// negotiateEncoding returns the preferred supported encoding, or an empty string if there is none.
+func negotiateEncoding(header string) string {
+	accepted := make(map[string]bool)
+
+	for _, item := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		quality := 1.0
+
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = parsed
+			}
+		}
+
+		accepted[strings.ToLower(strings.TrimSpace(name))] = quality > 0
+	}
+
+	for _, encoding := range []string{"br", "gzip"} {
+		if enabled, ok := accepted[encoding]; enabled || (!ok && accepted["*"]) {
+			return encoding
+		}
+	}
+
+	return ""
+}
+
+// compressWriter buffers the beginning of a response to only compress it once it's large enough.
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding   string
+	buffer     []byte
+	compressor io.WriteCloser
+	passed     bool // The response is written as it is
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if w.compressor != nil {
+		return w.compressor.Write(data)
+	} else if w.passed || !w.compressible() {
+		w.passed = true
+		return w.ResponseWriter.Write(data)
+	}
+
+	w.buffer = append(w.buffer, data...)
+	if len(w.buffer) >= compressMinSize {
+		if err := w.startCompression(); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(data), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *compressWriter) Flush() {
+	if err := w.flushBuffer(); err == nil && w.compressor != nil {
+		if flusher, ok := w.compressor.(interface{ Flush() error }); ok {
+			_ = flusher.Flush()
+		}
+	}
+
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) close() {
+	if w.compressor != nil {
+		_ = w.compressor.Close()
+	} else {
+		_ = w.flushBuffer()
+	}
+}
+
+// flushBuffer writes a buffered response which didn't reach the size to be compressed as it is.
+func (w *compressWriter) flushBuffer() error {
+	if w.compressor != nil || w.passed {
+		return nil
+	}
+
+	w.passed = true
+	if len(w.buffer) == 0 {
+		return nil
+	}
+
+	_, err := w.ResponseWriter.Write(w.buffer)
+	w.buffer = nil
+	return err
+}
+
+func (w *compressWriter) startCompression() error {
+	header := w.Header()
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+
+	if w.encoding == "br" {
+		w.compressor = brotli.NewWriterLevel(w.ResponseWriter, brotli.DefaultCompression)
+	} else {
+		w.compressor, _ = gzip.NewWriterLevel(w.ResponseWriter, gzip.DefaultCompression)
+	}
+
+	_, err := w.compressor.Write(w.buffer)
+	w.buffer = nil
+	return err
+}
+
+// compressible reports whether the response may be compressed, event streams are left alone to not delay events.
+func (w *compressWriter) compressible() bool {
+	status := w.Status()
+
+	return status != http.StatusNoContent &&
+		status != http.StatusNotModified &&
+		w.Header().Get("Content-Encoding") == "" &&
+		!strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream")
+}
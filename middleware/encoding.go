@@ -0,0 +1,243 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Data is stored as JSON, these binary encodings are converted from and to it at the edge.
+const (
+	jsonContentType    = "application/json"
+	cborContentType    = "application/cbor"
+	msgpackContentType = "application/msgpack"
+)
+
+var errUnsupportedValue = errors.New("value can't be represented as JSON")
+
+var cborDecoder, _ = cbor.DecOptions{
+	DefaultMapType: reflect.TypeOf(map[string]any(nil)),
+}.DecMode()
+
+// ConvertBody converts CBOR and MessagePack request bodies to JSON, the JSON has to fit into n bytes as well.
+// It has to come after LimitBodySize and before MinifyJson.
+func ConvertBody(n int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		contentType := c.ContentType()
+
+		if contentType == cborContentType || contentType == msgpackContentType {
+			data, err := io.ReadAll(c.Request.Body)
+			if err == nil {
+				data, err = toJson(contentType, data)
+			}
+
+			// Errors are passed on to the handler, it decides on the response
+			if err != nil {
+				c.Request.Body = io.NopCloser(&errorReader{err: err})
+			} else {
+				c.Request.Body = http.MaxBytesReader(c.Writer, io.NopCloser(bytes.NewReader(data)), n)
+			}
+
+			c.Request.ContentLength = -1
+			c.Request.Header.Set("Content-Length", "-1")
+			c.Request.Header.Set("Content-Type", jsonContentType)
+		}
+
+		c.Next()
+	}
+}
+
+// ConvertResponse converts JSON responses to CBOR or MessagePack if the client prefers it via Accept.
+func ConvertResponse() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Writer.Header().Add("Vary", "Accept")
+		contentType := negotiateContentType(c.GetHeader("Accept"))
+
+		if contentType == jsonContentType {
+			c.Next()
+			return
+		}
+
+		writer := &convertWriter{ResponseWriter: c.Writer, contentType: contentType, head: c.Request.Method == http.MethodHead}
+		c.Writer = writer
+
+		defer writer.close()
+		c.Next()
+	}
+}
+
+// negotiateContentType returns the encoding with the highest quality in the Accept header, JSON if there is a tie.
+func negotiateContentType(header string) string {
+	if strings.TrimSpace(header) == "" {
+		return jsonContentType
+	}
+
+	qualities := make(map[string]float64)
+	for _, item := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(item), ";")
+		quality := 1.0
+
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				quality = parsed
+			}
+		}
+
+		qualities[strings.ToLower(strings.TrimSpace(name))] = quality
+	}
+
+	best, bestQuality := jsonContentType, -1.0
+	for _, contentType := range []string{jsonContentType, cborContentType, msgpackContentType} {
+		quality, ok := qualities[contentType]
+
+		if !ok {
+			if quality, ok = qualities["application/*"]; !ok {
+				quality = qualities["*/*"]
+			}
+		}
+
+		if quality > bestQuality {
+			best, bestQuality = contentType, quality
+		}
+	}
+
+	// Clients not accepting any of them still get JSON
+	if bestQuality <= 0 {
+		return jsonContentType
+	}
+
+	return best
+}
+
+// convertWriter buffers JSON responses to convert them once they're complete.
+type convertWriter struct {
+	gin.ResponseWriter
+	contentType string
+	buffer      bytes.Buffer
+	passed      bool // The response isn't JSON and is written as it is
+	head        bool // There is no body, only the headers describing it are converted
+}
+
+func (w *convertWriter) Write(data []byte) (int, error) {
+	if w.passed || !strings.HasPrefix(w.Header().Get("Content-Type"), jsonContentType) {
+		w.passed = true
+		return w.ResponseWriter.Write(data)
+	}
+
+	return w.buffer.Write(data)
+}
+
+func (w *convertWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *convertWriter) close() {
+	if w.head && !w.passed && w.buffer.Len() == 0 && strings.HasPrefix(w.Header().Get("Content-Type"), jsonContentType) {
+
+		// The length of the converted body is unknown without converting it
+		w.Header().Set("Content-Type", w.contentType)
+		w.Header().Del("Content-Length")
+		return
+	} else if w.passed || w.buffer.Len() == 0 {
+		return
+	}
+
+	data, err := fromJson(w.contentType, w.buffer.Bytes())
+	if err != nil {
+
+		// Everything JSON can represent can be represented in both encodings
+		_, _ = w.ResponseWriter.Write(w.buffer.Bytes())
+		return
+	}
+
+	w.Header().Set("Content-Type", w.contentType)
+	_, _ = w.ResponseWriter.Write(data)
+}
+
+func toJson(contentType string, data []byte) ([]byte, error) {
+	var value any
+	var err error
+
+	if contentType == cborContentType {
+		err = cborDecoder.Unmarshal(data, &value)
+	} else {
+		err = msgpack.Unmarshal(data, &value)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, errUnsupportedValue
+	}
+
+	return encoded, nil
+}
+
+func fromJson(contentType string, data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	value = convertNumbers(value)
+	if contentType == cborContentType {
+		return cbor.Marshal(value)
+	}
+
+	var buf bytes.Buffer
+	encoder := msgpack.NewEncoder(&buf)
+	encoder.UseCompactInts(true)
+
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// convertNumbers replaces all json.Number values with integers, if possible, or floats.
+func convertNumbers(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		} else if f, err := v.Float64(); err == nil {
+			return f
+		}
+
+		return v.String()
+	case map[string]any:
+		for key, item := range v {
+			v[key] = convertNumbers(item)
+		}
+	case []any:
+		for i, item := range v {
+			v[i] = convertNumbers(item)
+		}
+	}
+
+	return value
+}
+
+type errorReader struct {
+	err error
+}
+
+func (r *errorReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -1,45 +1,54 @@
 package middleware
 
 import (
+	"bytes"
 	"github.com/gin-gonic/gin"
 	"github.com/tdewolff/minify/v2"
 	"github.com/tdewolff/minify/v2/json"
-	"github.com/tdewolff/parse/v2"
 	"io"
-	"net/http"
 )
 
 func MinifyJson() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if (c.Request.Method == "POST" || c.Request.Method == "PUT" || c.Request.Method == "PATCH") && c.Request.Header.Get("Content-Type") == "application/json" {
 
-			m := minify.New()
-			m.AddFunc("application/json", json.Minify)
+			m := newJsonMinifier()
 
 			bodyReader := c.Request.Body
 			defer bodyReader.Close()
 
 			minifyReader, minifyWriter := io.Pipe()
+			defer minifyReader.Close()
 
 			c.Request.Body = minifyReader
 			c.Request.ContentLength = -1
 			c.Request.Header.Set("Content-Length", "-1")
 
 			go func() {
-				defer minifyWriter.Close()
 
-				err := m.Minify("application/json", minifyWriter, bodyReader)
-
-				if _, ok := err.(*parse.Error); ok {
-					c.AbortWithStatus(http.StatusBadRequest)
-				} else if _, ok = err.(*http.MaxBytesError); ok {
-					c.AbortWithStatus(http.StatusRequestEntityTooLarge)
-				} else if err != nil {
-					c.AbortWithStatus(http.StatusInternalServerError)
-				}
+				// Errors are passed on to the reader, this way a partially minified body
+				// never reaches the handler and the handler decides on the response.
+				minifyWriter.CloseWithError(m.Minify("application/json", minifyWriter, bodyReader))
 			}()
 		}
 
 		c.Next()
 	}
 }
+
+// MinifyJsonBytes minifies and validates json which didn't pass through MinifyJson, e.g. if it's been created by the server.
+func MinifyJsonBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	if err := newJsonMinifier().Minify("application/json", &buf, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func newJsonMinifier() *minify.M {
+	m := minify.New()
+	m.AddFunc("application/json", json.Minify)
+	return m
+}
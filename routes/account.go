@@ -4,7 +4,9 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/simonwep/genesis/core"
+	"go.uber.org/zap"
 	"net/http"
+	"strconv"
 )
 
 type updateBody struct {
@@ -41,3 +43,56 @@ func UpdateAccount(c *gin.Context) {
 		c.Status(http.StatusOK)
 	}
 }
+
+type quota struct {
+	Used      int64  `json:"used"`
+	Limit     *int64 `json:"limit"`
+	Remaining *int64 `json:"remaining"`
+}
+
+func AccountUsage(c *gin.Context) {
+	user := authenticateUser(c)
+
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	} else if usage, err := core.GetUsageForUser(user.Name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve usage"})
+		core.Logger.Error("failed to retrieve usage", zap.Error(err))
+	} else {
+		c.JSON(http.StatusOK, gin.H{
+			"bytes": newQuota(usage.Bytes, core.Config.AppQuotaPerUser),
+			"keys":  newQuota(usage.Keys, core.Config.AppKeysPerUser),
+		})
+	}
+}
+
+// setQuotaHeaders adds the current usage of a user as X-Quota-* headers to the response.
+func setQuotaHeaders(c *gin.Context, name string) {
+	usage, err := core.GetUsageForUser(name)
+	if err != nil {
+		core.Logger.Error("failed to retrieve usage", zap.Error(err))
+		return
+	}
+
+	for unit, q := range map[string]quota{
+		"Bytes": newQuota(usage.Bytes, core.Config.AppQuotaPerUser),
+		"Keys":  newQuota(usage.Keys, core.Config.AppKeysPerUser),
+	} {
+		c.Header("X-Quota-"+unit+"-Used", strconv.FormatInt(q.Used, 10))
+
+		if q.Limit != nil {
+			c.Header("X-Quota-"+unit+"-Limit", strconv.FormatInt(*q.Limit, 10))
+			c.Header("X-Quota-"+unit+"-Remaining", strconv.FormatInt(*q.Remaining, 10))
+		}
+	}
+}
+
+// newQuota creates a quota for the given usage, a limit of zero means unlimited.
+func newQuota(used, limit int64) quota {
+	if limit <= 0 {
+		return quota{Used: used}
+	}
+
+	remaining := max(limit-used, 0)
+	return quota{Used: used, Limit: &limit, Remaining: &remaining}
+}
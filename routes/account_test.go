@@ -4,6 +4,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -40,3 +41,63 @@ func TestUpdatePassword(t *testing.T) {
 		},
 	})
 }
+
+func TestUsage(t *testing.T) {
+	token := loginUser(t)
+	body := "[" + strings.Repeat("1,", 299) + "1]"      // 601 bytes
+	largeBody := "[" + strings.Repeat("1,", 449) + "1]" // 901 bytes
+
+	for _, key := range []string{"foo", "bar"} {
+		tryAuthorizedPost("/data/"+key, AuthorizedBodyConfig{
+			Body:  body,
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	tryAuthorizedPost("/data/baz", AuthorizedBodyConfig{
+		Body:  "[1]",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "1205", response.Header().Get("X-Quota-Bytes-Used"))
+			assert.Equal(t, "2000", response.Header().Get("X-Quota-Bytes-Limit"))
+			assert.Equal(t, "795", response.Header().Get("X-Quota-Bytes-Remaining"))
+			assert.Equal(t, "3", response.Header().Get("X-Quota-Keys-Used"))
+			assert.Equal(t, "0", response.Header().Get("X-Quota-Keys-Remaining"))
+		},
+	})
+
+	tryAuthorizedPost("/data/baz", AuthorizedBodyConfig{
+		Body:  largeBody,
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	tryAuthorizedDelete("/data/foo", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/baz", AuthorizedBodyConfig{
+		Body:  largeBody,
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/account/usage", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"bytes\":{\"used\":1502,\"limit\":2000,\"remaining\":498},\"keys\":{\"used\":2,\"limit\":3,\"remaining\":1}}", response.Body.String())
+		},
+	})
+}
@@ -0,0 +1,30 @@
+package routes
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"go.uber.org/zap"
+)
+
+func Backup(c *gin.Context) {
+	user := authenticateUser(c)
+
+	if user == nil || !user.Admin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+	} else {
+		filename := "genesis-" + time.Now().UTC().Format("20060102-150405") + ".backup"
+
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.Header("Cache-Control", "no-store")
+		c.Status(http.StatusOK)
+
+		// The status has been sent already, an incomplete backup is recognized by its missing checksum
+		if _, err := core.WriteBackup(c.Writer, 0); err != nil {
+			core.Logger.Error("failed to write backup", zap.Error(err))
+		}
+	}
+}
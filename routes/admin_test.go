@@ -0,0 +1,115 @@
+package routes
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simonwep/genesis/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackup(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedGet("/admin/backup", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	admin := loginAdmin(t)
+	var backup []byte
+
+	tryAuthorizedPost("/data/foo", AuthorizedBodyConfig{
+		Body:  "{\"foo\": \"bar\"}",
+		Token: admin,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/admin/backup", AuthorizedConfig{
+		Token: admin,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "application/octet-stream", response.Header().Get("Content-Type"))
+			assert.Contains(t, response.Header().Get("Content-Disposition"), "attachment")
+			backup = response.Body.Bytes()
+		},
+	})
+
+	if assert.Greater(t, len(backup), sha256.Size) {
+		checksum := sha256.Sum256(backup[:len(backup)-sha256.Size])
+		assert.True(t, bytes.HasPrefix(backup, []byte("GENESISB")))
+		assert.Equal(t, checksum[:], backup[len(backup)-sha256.Size:])
+		assert.True(t, bytes.Contains(backup, []byte("{\"foo\":\"bar\"}")))
+	}
+
+	// Backups are verified before anything is loaded
+	dir := t.TempDir()
+	valid, corrupted := filepath.Join(dir, "valid.backup"), filepath.Join(dir, "corrupted.backup")
+	assert.NoError(t, os.WriteFile(valid, backup, 0o600))
+	assert.NoError(t, os.WriteFile(corrupted, append(bytes.Clone(backup[:len(backup)-1]), backup[len(backup)-1]^1), 0o600))
+
+	assert.ErrorIs(t, core.RestoreBackupFiles([]string{corrupted}), core.ErrBackupChecksum)
+	assert.ErrorIs(t, core.RestoreBackupFiles([]string{valid, valid}), core.ErrBackupIncremental)
+	assert.ErrorIs(t, core.RestoreBackupFiles([]string{valid}), core.ErrRestoreNotEmpty)
+}
+
+func TestScheduledBackups(t *testing.T) {
+	token := loginUser(t)
+	config := core.Config
+
+	core.Config.AppBackupInterval = time.Hour
+	core.Config.AppBackupDir = t.TempDir()
+	core.Config.AppBackupKeep = 0
+	core.Config.AppBackupPassphrase = []byte("correct horse battery staple")
+	defer func() { core.Config = config }()
+
+	// Rotation and incremental backups are covered by the tests of core for each backend
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, core.RunScheduledBackup())
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	entries, err := os.ReadDir(core.Config.AppBackupDir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.True(t, strings.HasSuffix(entries[0].Name(), "-full.backup"))
+
+	tryAuthorizedGet("/health", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var body struct {
+				LastBackup *time.Time `json:"lastBackup"`
+			}
+
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.NotNil(t, body.LastBackup)
+		},
+	})
+
+	// Backups are encrypted with the passphrase
+	backup := filepath.Join(core.Config.AppBackupDir, entries[0].Name())
+	data, err := os.ReadFile(backup)
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(data, []byte("GENESISE")))
+
+	assert.ErrorIs(t, core.RestoreBackupFiles([]string{backup}), core.ErrRestoreNotEmpty)
+
+	core.Config.AppBackupPassphrase = []byte("wrong")
+	assert.ErrorIs(t, core.RestoreBackupFiles([]string{backup}), core.ErrBackupPassphrase)
+
+	core.Config.AppBackupPassphrase = nil
+	assert.ErrorIs(t, core.RestoreBackupFiles([]string{backup}), core.ErrBackupEncrypted)
+}
@@ -0,0 +1,167 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"go.uber.org/zap"
+)
+
+type batchOperation struct {
+	Op       string          `json:"op"`
+	Key      string          `json:"key"`
+	Value    json.RawMessage `json:"value,omitempty"`
+	Type     string          `json:"type,omitempty"`
+	Revision *uint64         `json:"revision,omitempty"`
+}
+
+type batchResult struct {
+	Key        string                 `json:"key"`
+	Status     int                    `json:"status"`
+	Revision   uint64                 `json:"revision,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+	Violations []core.SchemaViolation `json:"violations,omitempty"`
+}
+
+func BatchData(c *gin.Context) {
+	user := authenticateUser(c)
+	var body []batchOperation
+
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	} else if err := c.ShouldBindJSON(&body); err != nil {
+		if isMaxBytesError(err) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "batch too large, limit is " + strconv.FormatInt(core.Config.AppBatchMaxSize/1000, 10) + " kilobytes"})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json, must be a list of operations"})
+		}
+	} else if operations, index, err := parseBatch(body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "operation " + strconv.Itoa(index) + " is invalid: " + err.Error()})
+	} else if metas, err := core.ApplyBatchForUser(user.Name, operations); err != nil {
+		var batchErr *core.BatchError
+
+		if errors.Is(err, core.ErrTooManyKeys) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "too many keys, limit is " + strconv.FormatInt(core.Config.AppKeysPerUser, 10)})
+		} else if errors.Is(err, core.ErrConflict) {
+			retryLater(c)
+		} else if errors.Is(err, core.ErrTxnTooBig) {
+
+			// The writes of all operations together exceed what fits into a transaction
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "batch too large, limit is " + strconv.FormatInt(core.Config.AppBatchMaxSize/1000, 10) + " kilobytes"})
+		} else if !errors.As(err, &batchErr) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to apply batch"})
+			core.Logger.Error("failed to apply batch", zap.Error(err))
+		} else {
+			status, message := batchErrorStatus(batchErr.Err)
+			results := make([]batchResult, len(body))
+
+			for i, op := range body {
+				results[i] = batchResult{Key: op.Key, Status: http.StatusFailedDependency}
+			}
+
+			results[batchErr.Index].Status = status
+			results[batchErr.Index].Error = message
+
+			if schemaErr := asSchemaError(batchErr.Err); schemaErr != nil {
+				results[batchErr.Index].Violations = schemaErr.Violations
+			}
+			c.JSON(status, gin.H{"error": "operation " + strconv.Itoa(batchErr.Index) + " failed", "results": results})
+		}
+	} else {
+		results := make([]batchResult, len(body))
+
+		for i, op := range body {
+			results[i] = batchResult{Key: op.Key, Status: http.StatusOK}
+
+			if metas[i] != nil {
+				results[i].Revision = metas[i].Revision
+			}
+		}
+
+		setQuotaHeaders(c, user.Name)
+		c.JSON(http.StatusOK, gin.H{"results": results})
+	}
+}
+
+// parseBatch validates all operations and converts them, the index of the first invalid one is returned on failure.
+func parseBatch(body []batchOperation) ([]core.BatchOperation, int, error) {
+	operations := make([]core.BatchOperation, len(body))
+
+	for i, op := range body {
+		operation := core.BatchOperation{Key: op.Key}
+
+		if !core.Config.AppKeyPattern.MatchString(op.Key) {
+			return nil, i, errors.New("key must match " + core.Config.AppKeyPattern.String())
+		} else if isReservedKey(op.Key) && op.Op == "set" {
+			return nil, i, errors.New("key " + op.Key + " is reserved")
+		}
+
+		if op.Revision != nil {
+			revision := *op.Revision
+			operation.Options.Precondition = func(current *core.DataMeta) bool {
+				return current != nil && current.Revision == revision
+			}
+		}
+
+		switch op.Op {
+		case "set":
+			if len(op.Value) == 0 {
+				return nil, i, errors.New("value is missing")
+			} else if int64(len(op.Value)) > core.Config.AppDataMaxSize {
+				return nil, i, errors.New("value too large, limit is " + strconv.FormatInt(core.Config.AppDataMaxSize, 10) + " kilobytes")
+			}
+
+			operation.Data = op.Value
+		case "delete":
+			operation.Delete = true
+		case "patch":
+			contentType := mergePatchContentType
+			if len(op.Value) == 0 {
+				return nil, i, errors.New("value is missing")
+			} else if op.Type == "json" {
+				contentType = jsonPatchContentType
+			} else if op.Type != "merge" {
+				return nil, i, errors.New("type must be merge or json")
+			}
+
+			patch, err := parsePatch(contentType, op.Value)
+			if err != nil {
+				return nil, i, errors.New("invalid patch")
+			}
+
+			operation.Update = patch
+		default:
+			return nil, i, errors.New("op must be set, delete or patch")
+		}
+
+		operations[i] = operation
+	}
+
+	return operations, 0, nil
+}
+
+func batchErrorStatus(err error) (int, string) {
+	if errors.Is(err, core.ErrKeyNotFound) {
+		return http.StatusNotFound, "key not found"
+	} else if errors.Is(err, core.ErrPreconditionFailed) {
+		return http.StatusPreconditionFailed, "revision does not match"
+	} else if errors.Is(err, jsonpatch.ErrTestFailed) {
+		return http.StatusConflict, err.Error()
+	} else if errors.Is(err, errPatchFailed) {
+		return http.StatusUnprocessableEntity, err.Error()
+	} else if errors.Is(err, core.ErrQuotaExceeded) {
+		return http.StatusForbidden, "storage quota exceeded"
+	} else if errors.Is(err, errDataTooLarge) {
+		return http.StatusRequestEntityTooLarge, "data too large"
+	} else if schemaErr := asSchemaError(err); schemaErr != nil {
+		return http.StatusUnprocessableEntity, schemaErr.Error()
+	}
+
+	core.Logger.Error("failed to apply batch operation", zap.Error(err))
+	return http.StatusInternalServerError, "internal server error"
+}
@@ -0,0 +1,120 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatch(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedPost("/data/foo", AuthorizedBodyConfig{
+		Body:  "{\"a\": 1}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/_batch", AuthorizedBodyConfig{
+		Body: `[
+			{"op": "set", "key": "bar", "value": {"hello": "world"}},
+			{"op": "patch", "key": "foo", "type": "merge", "value": {"b": 2}, "revision": 1},
+			{"op": "patch", "key": "bar", "type": "json", "value": [{"op": "add", "path": "/x", "value": true}]}
+		]`,
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"results\":[{\"key\":\"bar\",\"status\":200,\"revision\":2},{\"key\":\"foo\",\"status\":200,\"revision\":2},{\"key\":\"bar\",\"status\":200,\"revision\":3}]}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"bar\":{\"hello\":\"world\",\"x\":true},\"foo\":{\"a\":1,\"b\":2}}", response.Body.String())
+		},
+	})
+}
+
+func TestBatchIsAtomic(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedPost("/data/foo", AuthorizedBodyConfig{
+		Body:  "{\"a\": 1}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	// stale revision
+	tryAuthorizedPost("/data/_batch", AuthorizedBodyConfig{
+		Body:  `[{"op": "set", "key": "bar", "value": 1}, {"op": "delete", "key": "foo", "revision": 3}]`,
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusPreconditionFailed, response.Code)
+			assert.Contains(t, response.Body.String(), "{\"key\":\"bar\",\"status\":424},{\"key\":\"foo\",\"status\":412")
+		},
+	})
+
+	// key deleted earlier in the same batch
+	tryAuthorizedPost("/data/_batch", AuthorizedBodyConfig{
+		Body:  `[{"op": "delete", "key": "foo"}, {"op": "patch", "key": "foo", "type": "json", "value": [{"op": "test", "path": "/a", "value": 2}]}]`,
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+		},
+	})
+
+	// too many keys
+	tryAuthorizedPost("/data/_batch", AuthorizedBodyConfig{
+		Body:  `[{"op": "set", "key": "a", "value": 1}, {"op": "set", "key": "b", "value": 1}, {"op": "set", "key": "c", "value": 1}]`,
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	// invalid operations
+	for _, body := range []string{
+		`{"op": "set", "key": "a", "value": 1}`,
+		`[{"op": "set", "key": "a"}]`,
+		`[{"op": "set", "key": "a.b", "value": 1}]`,
+		`[{"op": "move", "key": "a"}]`,
+		`[{"op": "patch", "key": "foo", "type": "xml", "value": {}}]`,
+		`[{"op": "patch", "key": "foo", "type": "merge"}]`,
+		`[{"op": "patch", "key": "foo", "type": "json"}]`,
+	} {
+		tryAuthorizedPost("/data/_batch", AuthorizedBodyConfig{
+			Body:  body,
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, response.Code, body)
+			},
+		})
+	}
+
+	large := `[{"op": "set", "key": "a", "value": "` + strings.Repeat("a", 3000) + `"}]`
+	tryAuthorizedPost("/data/_batch", AuthorizedBodyConfig{
+		Body:  large,
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusRequestEntityTooLarge, response.Code)
+			assert.Contains(t, response.Body.String(), "batch too large, limit is 3 kilobytes")
+		},
+	})
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"foo\":{\"a\":1}}", response.Body.String())
+		},
+	})
+}
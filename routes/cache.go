@@ -0,0 +1,44 @@
+package routes
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+)
+
+// notModified sets the caching headers of a response and reports whether the copy cached by the client is
+// still up-to-date, in which case it should be answered with 304. The modification time is optional.
+func notModified(c *gin.Context, etag string, modified time.Time) bool {
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", core.Config.AppCacheControl)
+
+	if !modified.IsZero() {
+		c.Header("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	// If-Modified-Since is ignored if If-None-Match is present
+	if header := c.GetHeader("If-None-Match"); header != "" {
+		for _, tag := range strings.Split(header, ",") {
+			if tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/"); tag == "*" || tag == etag {
+				return true
+			}
+		}
+	} else if header := c.GetHeader("If-Modified-Since"); header != "" && !modified.IsZero() {
+		if since, err := http.ParseTime(header); err == nil {
+			return !modified.Truncate(time.Second).After(since)
+		}
+	}
+
+	return false
+}
+
+// formatContentETag returns an ETag derived from the data itself, for responses without a single revision.
+func formatContentETag(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "\"" + hex.EncodeToString(sum[:16]) + "\""
+}
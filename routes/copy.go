@@ -0,0 +1,61 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"go.uber.org/zap"
+)
+
+func RenameData(c *gin.Context) {
+	copyData(c, core.RenameDataForUser)
+}
+
+func CopyData(c *gin.Context) {
+	copyData(c, core.CopyDataForUser)
+}
+
+func copyData(c *gin.Context, fn func(name, key, target string, overwrite bool, opts core.WriteOptions) (*core.DataMeta, error)) {
+	key := c.Param("key")
+	target := c.Query("to")
+	user := authenticateUser(c)
+
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	} else if target == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "target is required as ?to=<key>"})
+	} else if !core.Config.AppKeyPattern.MatchString(key) || !core.Config.AppKeyPattern.MatchString(target) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key and target must match " + core.Config.AppKeyPattern.String()})
+	} else if isReservedKey(target) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key " + target + " is reserved"})
+	} else if key == target {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "target must differ from key"})
+	} else if meta, err := fn(user.Name, key, target, c.Query("overwrite") == "true", core.WriteOptions{Precondition: ifMatch(c)}); err != nil {
+		if errors.Is(err, core.ErrKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "key not found"})
+		} else if errors.Is(err, core.ErrKeyExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": "target already exists"})
+		} else if errors.Is(err, core.ErrPreconditionFailed) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "revision does not match"})
+		} else if errors.Is(err, core.ErrTooManyKeys) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "too many keys, limit is " + strconv.FormatInt(core.Config.AppKeysPerUser, 10)})
+		} else if errors.Is(err, core.ErrQuotaExceeded) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "storage quota exceeded, limit is " + strconv.FormatInt(core.Config.AppQuotaPerUser, 10) + " bytes"})
+		} else if schemaErr := asSchemaError(err); schemaErr != nil {
+			schemaViolation(c, schemaErr)
+		} else if errors.Is(err, core.ErrConflict) {
+			retryLater(c)
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to copy data"})
+			core.Logger.Error("failed to copy data", zap.Error(err))
+		}
+	} else {
+		setQuotaHeaders(c, user.Name)
+		setTTLHeader(c, meta)
+		c.Header("ETag", formatETag(meta))
+		c.Status(http.StatusOK)
+	}
+}
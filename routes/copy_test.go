@@ -0,0 +1,170 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenameData(t *testing.T) {
+	token := loginUser(t)
+
+	for _, key := range []string{"foo", "bar"} {
+		tryAuthorizedPost("/data/"+key+"?ttl=1h", AuthorizedBodyConfig{
+			Body:  "{\"key\": \"" + key + "\"}",
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	tryAuthorizedPost("/data/foo/rename?to=baz", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "\"4\"", response.Header().Get("ETag"))
+			assert.Equal(t, "3600", response.Header().Get("X-Genesis-TTL"))
+		},
+	})
+
+	tryAuthorizedGet("/data/foo", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNoContent, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/baz", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"key\":\"foo\"}", response.Body.String())
+		},
+	})
+
+	// Renamed keys aren't moved into the trash
+	assert.Empty(t, getTrash(t, token))
+
+	tryAuthorizedPost("/data/baz/rename?to=bar", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusConflict, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/baz/rename?to=bar&overwrite=true", AuthorizedBodyConfig{
+		Token:   token,
+		Headers: map[string]string{"If-Match": "\"1\""},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusPreconditionFailed, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/baz/rename?to=bar&overwrite=true", AuthorizedBodyConfig{
+		Token:   token,
+		Headers: map[string]string{"If-Match": "\"4\""},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "\"3\"", response.Header().Get("ETag"))
+		},
+	})
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, "{\"bar\":{\"key\":\"foo\"}}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedPost("/data/missing/rename?to=other", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+		},
+	})
+
+	for _, url := range []string{"/data/bar/rename", "/data/bar/rename?to=bar", "/data/bar/rename?to=b//r"} {
+		tryAuthorizedPost(url, AuthorizedBodyConfig{
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, response.Code)
+			},
+		})
+	}
+}
+
+func TestCopyData(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedPost("/data/foo", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"world\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	for _, key := range []string{"bar", "baz"} {
+		tryAuthorizedPost("/data/foo/copy?to="+key, AuthorizedBodyConfig{
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+				assert.Empty(t, response.Header().Get("X-Genesis-TTL"))
+			},
+		})
+	}
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, "{\"bar\":{\"hello\":\"world\"},\"baz\":{\"hello\":\"world\"},\"foo\":{\"hello\":\"world\"}}", response.Body.String())
+		},
+	})
+
+	// The key limit applies to copies
+	tryAuthorizedDelete("/data/baz", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/qux", AuthorizedBodyConfig{
+		Body:  "{}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/foo/copy?to=baz", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/foo/copy?to=qux", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusConflict, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/foo/copy?to=qux&overwrite=true", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/qux", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, "{\"hello\":\"world\"}", response.Body.String())
+		},
+	})
+}
@@ -5,23 +5,56 @@ import (
 	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
-	"github.com/dgraph-io/badger/v4"
 	"github.com/gin-gonic/gin"
 	"github.com/simonwep/genesis/core"
 	"go.uber.org/zap"
 )
 
+const (
+	ttlHeader = "X-Genesis-TTL"
+	maxTTL    = 100 * 365 * 24 * time.Hour
+)
+
 func Data(c *gin.Context) {
 	user := authenticateUser(c)
 
 	if user == nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	} else if c.Query("meta") == "true" {
+		if meta, err := core.GetAllMetaFromUser(user.Name); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve metadata"})
+			core.Logger.Error("failed to retrieve metadata", zap.Error(err))
+		} else {
+			c.JSON(http.StatusOK, meta)
+		}
+	} else if cursor, ok := c.GetQuery("since"); ok {
+		if changes, err := core.GetChangesForUser(user.Name, cursor); err != nil {
+			if errors.Is(err, core.ErrInvalidCursor) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			} else if errors.Is(err, core.ErrCursorExpired) {
+				c.JSON(http.StatusGone, gin.H{"error": "full resync required"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve changes"})
+				core.Logger.Error("failed to retrieve changes", zap.Error(err))
+			}
+		} else {
+			setQuotaHeaders(c, user.Name)
+			c.JSON(http.StatusOK, changes)
+		}
 	} else if data, err := core.GetAllDataFromUser(user.Name); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve data"})
 		core.Logger.Error("failed to retrieve data", zap.Error(err))
 	} else {
-		c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+		setQuotaHeaders(c, user.Name)
+
+		if notModified(c, formatContentETag(data), time.Time{}) {
+			c.Status(http.StatusNotModified)
+		} else {
+			c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+		}
 	}
 }
 
@@ -33,15 +66,37 @@ func DataByKey(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 	} else if !core.Config.AppKeyPattern.MatchString(key) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "key must match " + core.Config.AppKeyPattern.String()})
-	} else if data, err := core.GetDataFromUser(user.Name, key); err != nil {
-		if errors.Is(err, badger.ErrKeyNotFound) {
+	} else if data, meta, err := core.GetDataFromUser(user.Name, key); err != nil {
+		if errors.Is(err, core.ErrKeyNotFound) {
 			c.Status(http.StatusNoContent)
 		} else {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve unit of data"})
 			core.Logger.Error("failed to retrieve unit of data", zap.Error(err))
 		}
+	} else if data, err = core.ResolvePointer(data, c.Query("pointer")); err != nil {
+		if errors.Is(err, core.ErrInvalidPointer) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else if errors.Is(err, core.ErrPointerNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve pointer"})
+			core.Logger.Error("failed to resolve pointer", zap.Error(err))
+		}
+	} else if data, err = projectFields(c, data); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to project fields"})
+		core.Logger.Error("failed to project fields", zap.Error(err))
 	} else {
-		c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+		setTTLHeader(c, meta)
+
+		if notModified(c, formatETag(meta), meta.Modified) {
+			c.Status(http.StatusNotModified)
+		} else if c.Request.Method == http.MethodHead {
+			c.Header("Content-Type", "application/json; charset=utf-8")
+			c.Header("Content-Length", strconv.Itoa(len(data)))
+			c.Status(http.StatusOK)
+		} else {
+			c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+		}
 	}
 }
 
@@ -53,18 +108,39 @@ func SetData(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 	} else if !core.Config.AppKeyPattern.MatchString(key) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "key must match " + core.Config.AppKeyPattern.String()})
+	} else if isReservedKey(key) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key " + key + " is reserved"})
 	} else if count := core.GetDataCountForUser(user.Name, key); count > core.Config.AppKeysPerUser {
 		c.JSON(http.StatusForbidden, gin.H{"error": "too many keys, limit is " + strconv.FormatInt(core.Config.AppKeysPerUser, 10)})
 	} else if size, err := getContentLength(c); err != nil || size > core.Config.AppDataMaxSize {
 		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request entity too large, limit is " + strconv.FormatInt(core.Config.AppDataMaxSize, 10) + " kilobytes"})
 	} else if body, err := c.GetRawData(); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		if isMaxBytesError(err) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request entity too large, limit is " + strconv.FormatInt(core.Config.AppDataMaxSize, 10) + " kilobytes"})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		}
 	} else if !json.Valid(body) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "body must be valid JSON"})
-	} else if err := core.SetDataForUser(user.Name, key, body); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to set data"})
-		core.Logger.Error("failed to set data", zap.Error(err))
+	} else if expires, err := parseExpiration(c); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ttl must be a positive duration or number of seconds, at most 100 years"})
+	} else if meta, err := core.SetDataForUser(user.Name, key, body, core.WriteOptions{Precondition: ifMatch(c), Expires: expires}); err != nil {
+		if errors.Is(err, core.ErrPreconditionFailed) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "revision does not match"})
+		} else if errors.Is(err, core.ErrQuotaExceeded) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "storage quota exceeded, limit is " + strconv.FormatInt(core.Config.AppQuotaPerUser, 10) + " bytes"})
+		} else if schemaErr := asSchemaError(err); schemaErr != nil {
+			schemaViolation(c, schemaErr)
+		} else if errors.Is(err, core.ErrConflict) {
+			retryLater(c)
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to set data"})
+			core.Logger.Error("failed to set data", zap.Error(err))
+		}
 	} else {
+		setQuotaHeaders(c, user.Name)
+		setTTLHeader(c, meta)
+		c.Header("ETag", formatETag(meta))
 		c.Status(http.StatusOK)
 	}
 }
@@ -77,10 +153,17 @@ func DeleteData(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 	} else if !core.Config.AppKeyPattern.MatchString(key) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "key must match " + core.Config.AppKeyPattern.String()})
-	} else if err := core.DeleteDataFromUser(user.Name, key); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete data"})
-		core.Logger.Error("failed to delete data", zap.Error(err))
+	} else if err := core.DeleteDataFromUser(user.Name, key, core.WriteOptions{Precondition: ifMatch(c)}); err != nil {
+		if errors.Is(err, core.ErrPreconditionFailed) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "revision does not match"})
+		} else if errors.Is(err, core.ErrConflict) {
+			retryLater(c)
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete data"})
+			core.Logger.Error("failed to delete data", zap.Error(err))
+		}
 	} else {
+		setQuotaHeaders(c, user.Name)
 		c.Status(http.StatusOK)
 	}
 }
@@ -88,3 +171,92 @@ func DeleteData(c *gin.Context) {
 func getContentLength(c *gin.Context) (int64, error) {
 	return strconv.ParseInt(c.GetHeader("Content-Length"), 10, 64)
 }
+
+// projectFields applies the comma separated fields query parameter to data, if present.
+func projectFields(c *gin.Context, data []byte) ([]byte, error) {
+	if fields := c.Query("fields"); fields == "" {
+		return data, nil
+	} else {
+		return core.ProjectFields(data, strings.Split(fields, ","))
+	}
+}
+
+func isMaxBytesError(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// parseExpiration returns the expiration for the ttl query parameter or X-Genesis-TTL header,
+// given either as duration (e.g. 24h) or in seconds. It's zero if neither is present.
+func parseExpiration(c *gin.Context) (time.Time, error) {
+	value := c.Query("ttl")
+	if value == "" {
+		value = c.GetHeader(ttlHeader)
+	}
+
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	ttl, err := time.ParseDuration(value)
+	if seconds, convErr := strconv.ParseInt(value, 10, 64); convErr == nil {
+		// Bounded before converting it, larger values would overflow
+		ttl, err = time.Duration(min(seconds, int64(maxTTL/time.Second)+1))*time.Second, nil
+	}
+
+	if err != nil {
+		return time.Time{}, err
+	} else if ttl < time.Second {
+		return time.Time{}, errors.New("ttl must be at least one second")
+	} else if ttl > maxTTL {
+		return time.Time{}, errors.New("ttl must be at most 100 years")
+	}
+
+	return time.Now().Add(ttl), nil
+}
+
+// setTTLHeader reports the seconds until the value expires, if it does.
+func setTTLHeader(c *gin.Context, meta *core.DataMeta) {
+	if !meta.Expires.IsZero() {
+		c.Header(ttlHeader, strconv.FormatInt(max(int64(time.Until(meta.Expires).Seconds()), 0), 10))
+	}
+}
+
+// retryLater responds to a write which kept conflicting with concurrent writes of the same user.
+func retryLater(c *gin.Context) {
+	c.Header("Retry-After", "1")
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": "too many concurrent writes, try again later"})
+}
+
+// isReservedKey reports whether key is the name of an endpoint below /data, which can't be stored.
+func isReservedKey(key string) bool {
+	return key == "_batch" || key == "_events" || key == "_trash"
+}
+
+// formatETag returns the revision as strong validator, revisions aren't reused for a key even after it's been deleted.
+func formatETag(meta *core.DataMeta) string {
+	return "\"" + strconv.FormatUint(meta.Revision, 10) + "\""
+}
+
+// ifMatch returns a precondition for the If-Match header, or nil if it's absent.
+func ifMatch(c *gin.Context) func(*core.DataMeta) bool {
+	header := c.GetHeader("If-Match")
+
+	if header == "" {
+		return nil
+	}
+
+	return func(current *core.DataMeta) bool {
+		if current == nil {
+			return false
+		}
+
+		for _, tag := range strings.Split(header, ",") {
+			if tag = strings.TrimSpace(tag); tag == "*" || tag == formatETag(current) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
@@ -1,13 +1,25 @@
 package routes
 
 import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/andybalholm/brotli"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/simonwep/genesis/core"
 	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 func TestGetAllData(t *testing.T) {
@@ -129,6 +141,60 @@ func TestInvalidKeys(t *testing.T) {
 	})
 }
 
+func TestReservedKeys(t *testing.T) {
+	token := loginUser(t)
+
+	expectReserved := func(response *httptest.ResponseRecorder) {
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		assert.Contains(t, response.Body.String(), "is reserved")
+	}
+
+	tryAuthorizedPost("/data/foo", AuthorizedBodyConfig{
+		Body:  "{}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	for _, key := range []string{"_events", "_trash"} {
+		tryAuthorizedPost("/data/"+key, AuthorizedBodyConfig{
+			Body:    "{}",
+			Token:   token,
+			Handler: expectReserved,
+		})
+
+		tryAuthorizedPost("/data/foo/copy?to="+key, AuthorizedBodyConfig{
+			Token:   token,
+			Handler: expectReserved,
+		})
+
+		tryAuthorizedPost("/data/foo/rename?to="+key, AuthorizedBodyConfig{
+			Token:   token,
+			Handler: expectReserved,
+		})
+
+		tryAuthorizedPost("/data/_trash/"+key+"/restore", AuthorizedBodyConfig{
+			Token:   token,
+			Handler: expectReserved,
+		})
+	}
+
+	tryAuthorizedPost("/data/_batch", AuthorizedBodyConfig{
+		Body:    `[{"op": "set", "key": "_batch", "value": {}}]`,
+		Token:   token,
+		Handler: expectReserved,
+	})
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"foo\":{}}", response.Body.String())
+		},
+	})
+}
+
 func TestInvalidKeysAllEndpoints(t *testing.T) {
 	token := loginUser(t)
 
@@ -274,3 +340,845 @@ func TestTooMany(t *testing.T) {
 		},
 	})
 }
+
+func TestRevisions(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedPost("/data/bar", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"world!\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "\"1\"", response.Header().Get("ETag"))
+		},
+	})
+
+	tryAuthorizedPost("/data/bar", AuthorizedBodyConfig{
+		Body:    "{\"hello\": \"there!\"}",
+		Token:   token,
+		Headers: map[string]string{"If-Match": "\"1\""},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "\"2\"", response.Header().Get("ETag"))
+		},
+	})
+
+	// stale revision
+	tryAuthorizedPost("/data/bar", AuthorizedBodyConfig{
+		Body:    "{\"hello\": \"world!\"}",
+		Token:   token,
+		Headers: map[string]string{"If-Match": "\"1\""},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusPreconditionFailed, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/bar", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "\"2\"", response.Header().Get("ETag"))
+			assert.Equal(t, "{\"hello\":\"there!\"}", response.Body.String())
+		},
+	})
+
+	// wildcard requires the key to exist
+	tryAuthorizedPost("/data/baz", AuthorizedBodyConfig{
+		Body:    "{\"hello\": \"world!\"}",
+		Token:   token,
+		Headers: map[string]string{"If-Match": "*"},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusPreconditionFailed, response.Code)
+		},
+	})
+
+	tryAuthorizedDelete("/data/bar", AuthorizedConfig{
+		Token:   token,
+		Headers: map[string]string{"If-Match": "\"1\""},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusPreconditionFailed, response.Code)
+		},
+	})
+
+	tryAuthorizedDelete("/data/bar", AuthorizedConfig{
+		Token:   token,
+		Headers: map[string]string{"If-Match": "\"1\", \"2\""},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	// revisions of deleted values aren't handed out again
+	tryAuthorizedPost("/data/bar", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"again!\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "\"4\"", response.Header().Get("ETag"))
+		},
+	})
+
+	tryAuthorizedPost("/data/bar", AuthorizedBodyConfig{
+		Body:    "{\"hello\": \"world!\"}",
+		Token:   token,
+		Headers: map[string]string{"If-Match": "\"1\", \"2\""},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusPreconditionFailed, response.Code)
+		},
+	})
+}
+
+func TestInvalidJSONWithTrailingData(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedPost("/data/bar", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"world!\"}}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/bar", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNoContent, response.Code)
+		},
+	})
+}
+
+func TestPartialReads(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedPost("/data/bar", AuthorizedBodyConfig{
+		Body:  "{\"title\": \"hi\", \"settings\": {\"theme\": \"dark\", \"a/b\": [1, {\"c\": 2}], \"lang\": \"en\"}, \"list\": [1, 2]}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	for query, expected := range map[string]string{
+		"pointer=/settings/theme":                   "\"dark\"",
+		"pointer=/settings/a~1b/1":                  "{\"c\":2}",
+		"pointer=/list/0":                           "1",
+		"fields=title,settings/lang":                "{\"title\":\"hi\",\"settings\":{\"lang\":\"en\"}}",
+		"fields=list,settings/theme,settings,nope":  "{\"settings\":{\"theme\":\"dark\",\"a/b\":[1,{\"c\":2}],\"lang\":\"en\"},\"list\":[1,2]}",
+		"pointer=/settings&fields=theme,lang,other": "{\"theme\":\"dark\",\"lang\":\"en\"}",
+	} {
+		tryAuthorizedGet("/data/bar?"+query, AuthorizedConfig{
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code, query)
+				assert.Equal(t, expected, response.Body.String(), query)
+			},
+		})
+	}
+
+	for _, pointer := range []string{"/nope", "/list/2", "/list/01", "/title/0"} {
+		tryAuthorizedGet("/data/bar?pointer="+pointer, AuthorizedConfig{
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotFound, response.Code, pointer)
+			},
+		})
+	}
+
+	tryAuthorizedGet("/data/bar?pointer=settings", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+}
+
+func TestMetadata(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedGet("/data?meta=true", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{}", response.Body.String())
+		},
+	})
+
+	for _, body := range []string{"{\"hello\": \"world!\"}", "{\"hello\": \"there!\"}"} {
+		tryAuthorizedPost("/data/bar", AuthorizedBodyConfig{
+			Body:  body,
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	tryAuthorizedGet("/data?meta=true", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var meta map[string]core.DataMeta
+			hash := sha256.Sum256([]byte("{\"hello\":\"there!\"}"))
+
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &meta))
+			assert.Len(t, meta, 1)
+			assert.Equal(t, uint64(2), meta["bar"].Revision)
+			assert.Equal(t, int64(18), meta["bar"].Size)
+			assert.Equal(t, hex.EncodeToString(hash[:]), meta["bar"].Hash)
+			assert.WithinDuration(t, time.Now(), meta["bar"].Modified, time.Minute)
+		},
+	})
+}
+
+func TestExpiringData(t *testing.T) {
+	token := loginUser(t)
+
+	for _, ttl := range []string{"0", "-5s", "soon", "500ms", "9999999999999", "876001h"} {
+		tryAuthorizedPost("/data/bar?ttl="+ttl, AuthorizedBodyConfig{
+			Body:  "{\"hello\": \"world!\"}",
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, response.Code, ttl)
+			},
+		})
+	}
+
+	for _, key := range []string{"foo", "bar", "baz"} {
+		tryAuthorizedPost("/data/"+key+"?ttl=1s", AuthorizedBodyConfig{
+			Body:  "{\"hello\": \"world!\"}",
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+				assert.Equal(t, "1", response.Header().Get("X-Genesis-TTL"))
+			},
+		})
+	}
+
+	tryAuthorizedPost("/data/bam", AuthorizedBodyConfig{
+		Body:    "{\"hello\": \"world!\"}",
+		Token:   token,
+		Headers: map[string]string{"X-Genesis-TTL": "3600"},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/foo", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NotEmpty(t, response.Header().Get("X-Genesis-TTL"))
+		},
+	})
+
+	time.Sleep(2 * time.Second)
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedPost("/data/bam", AuthorizedBodyConfig{
+		Body:    "{\"hello\": \"world!\"}",
+		Token:   token,
+		Headers: map[string]string{"X-Genesis-TTL": "3600"},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "3600", response.Header().Get("X-Genesis-TTL"))
+			assert.Equal(t, "18", response.Header().Get("X-Quota-Bytes-Used"))
+		},
+	})
+
+	tryAuthorizedPost("/data/bam", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"there!\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Empty(t, response.Header().Get("X-Genesis-TTL"))
+		},
+	})
+
+	tryAuthorizedGet("/data/bam", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Empty(t, response.Header().Get("X-Genesis-TTL"))
+		},
+	})
+}
+
+func TestDeltaSync(t *testing.T) {
+	token := loginUser(t)
+
+	sync := func(cursor string, expected core.Changes) string {
+		var changes core.Changes
+
+		tryAuthorizedGet("/data?since="+cursor, AuthorizedConfig{
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+				assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &changes))
+				assert.Equal(t, expected.Changed, changes.Changed)
+				assert.ElementsMatch(t, expected.Deleted, changes.Deleted)
+			},
+		})
+
+		return changes.Cursor
+	}
+
+	cursor := sync("", core.Changes{Changed: map[string]json.RawMessage{}, Deleted: []string{}})
+
+	for _, key := range []string{"foo", "bar"} {
+		tryAuthorizedPost("/data/"+key, AuthorizedBodyConfig{
+			Body:  "{\"hello\": \"" + key + "\"}",
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	cursor = sync(cursor, core.Changes{
+		Changed: map[string]json.RawMessage{"foo": json.RawMessage("{\"hello\":\"foo\"}"), "bar": json.RawMessage("{\"hello\":\"bar\"}")},
+		Deleted: []string{},
+	})
+
+	tryAuthorizedPost("/data/baz?ttl=1", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"baz\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedDelete("/data/bar", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	cursor = sync(cursor, core.Changes{
+		Changed: map[string]json.RawMessage{"baz": json.RawMessage("{\"hello\":\"baz\"}")},
+		Deleted: []string{"bar"},
+	})
+
+	cursor = sync(cursor, core.Changes{Changed: map[string]json.RawMessage{}, Deleted: []string{}})
+	time.Sleep(2 * time.Second)
+
+	// Expired values are reported as deleted before and after their expiration is settled, but only once
+	next := sync(cursor, core.Changes{Changed: map[string]json.RawMessage{}, Deleted: []string{"baz"}})
+	sync(next, core.Changes{Changed: map[string]json.RawMessage{}, Deleted: []string{}})
+
+	tryAuthorizedPost("/data/bar", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"again\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	sync(cursor, core.Changes{
+		Changed: map[string]json.RawMessage{"bar": json.RawMessage("{\"hello\":\"again\"}")},
+		Deleted: []string{"baz"},
+	})
+
+	for cursor, status := range map[string]int{
+		"abc":    http.StatusBadRequest,
+		"1":      http.StatusBadRequest,
+		"999-1":  http.StatusGone,
+		"1-1000": http.StatusGone,
+	} {
+		tryAuthorizedGet("/data?since="+cursor, AuthorizedConfig{
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, status, response.Code, cursor)
+			},
+		})
+	}
+}
+
+func TestCompressedData(t *testing.T) {
+	token := loginUser(t)
+	body := "{\"list\":[" + strings.Repeat("\"compressible\",", 40) + "\"end\"]}"
+
+	for range 2 {
+		tryAuthorizedPost("/data/foo", AuthorizedBodyConfig{
+			Body:  body,
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	for _, url := range []string{"/data/foo", "/data/foo/history/1"} {
+		tryAuthorizedGet(url, AuthorizedConfig{
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+				assert.Equal(t, body, response.Body.String())
+			},
+		})
+	}
+
+	tryAuthorizedGet("/data?meta=true", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var meta map[string]core.DataMeta
+
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &meta))
+			assert.Equal(t, int64(len(body)), meta["foo"].Size)
+		},
+	})
+
+	tryAuthorizedPatch("/data/foo", AuthorizedBodyConfig{
+		Body:    "{\"list\": null}",
+		Token:   token,
+		Headers: mergePatchHeaders,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"foo\":{}}", response.Body.String())
+		},
+	})
+}
+
+func TestRecompressDatabase(t *testing.T) {
+	token := loginUser(t)
+	body := "{\"list\":[" + strings.Repeat("\"compressible\",", 40) + "\"end\"]}"
+
+	for _, key := range []string{"foo", "foo", "bar"} {
+		tryAuthorizedPost("/data/"+key, AuthorizedBodyConfig{
+			Body:  body,
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	tryAuthorizedDelete("/data/bar", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	minSize := core.Config.AppCompressionMinSize
+	defer func() { core.Config.AppCompressionMinSize = minSize }()
+
+	// Values, previous versions and trashed values are rewritten once
+	core.Config.AppCompressionMinSize = 0
+	changed, err := core.RecompressDatabase()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, changed)
+
+	changed, err = core.RecompressDatabase()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, changed)
+
+	core.Config.AppCompressionMinSize = minSize
+	changed, err = core.RecompressDatabase()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, changed)
+
+	for _, url := range []string{"/data/foo", "/data/foo/history/1"} {
+		tryAuthorizedGet(url, AuthorizedConfig{
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+				assert.Equal(t, body, response.Body.String())
+			},
+		})
+	}
+
+	tryAuthorizedPost("/data/_trash/bar/restore", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/bar", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, body, response.Body.String())
+		},
+	})
+}
+
+func TestCompressedResponses(t *testing.T) {
+	token := loginUser(t)
+	value := "{\"list\":[" + strings.Repeat("\"value\",", 70) + "\"end\"]}"
+
+	for _, key := range []string{"foo", "bar"} {
+		tryAuthorizedPost("/data/"+key, AuthorizedBodyConfig{
+			Body:  value,
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	expected := "{\"bar\":" + value + ",\"foo\":" + value + "}"
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"br":   func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+	}
+
+	for accept, encoding := range map[string]string{"gzip": "gzip", "gzip, br": "br", "br;q=0, *": "gzip", "*;q=0.5": "br"} {
+		tryAuthorizedGet("/data", AuthorizedConfig{
+			Token:   token,
+			Headers: map[string]string{"Accept-Encoding": accept},
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+				assert.Equal(t, encoding, response.Header().Get("Content-Encoding"), accept)
+				assert.Equal(t, "Accept-Encoding", response.Header().Get("Vary"))
+
+				reader, err := decoders[encoding](response.Body)
+				assert.NoError(t, err)
+
+				body, err := io.ReadAll(reader)
+				assert.NoError(t, err)
+				assert.Equal(t, expected, string(body))
+			},
+		})
+	}
+
+	// Small responses and those without a supported encoding are sent as they are
+	for url, accept := range map[string]string{"/data/foo?fields=end": "gzip", "/data": "identity, br;q=0"} {
+		tryAuthorizedGet(url, AuthorizedConfig{
+			Token:   token,
+			Headers: map[string]string{"Accept-Encoding": accept},
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+				assert.Empty(t, response.Header().Get("Content-Encoding"))
+				assert.True(t, json.Valid(response.Body.Bytes()))
+			},
+		})
+	}
+}
+
+func TestCompressedUpload(t *testing.T) {
+	token := loginUser(t)
+
+	compress := func(data string) string {
+		var buf bytes.Buffer
+		writer := gzip.NewWriter(&buf)
+		_, _ = writer.Write([]byte(data))
+		_ = writer.Close()
+		return buf.String()
+	}
+
+	tryAuthorizedPost("/data/foo", AuthorizedBodyConfig{
+		Body:    compress("{\"hello\": \"world!\"}"),
+		Token:   token,
+		Headers: map[string]string{"Content-Encoding": "gzip"},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/foo", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"hello\":\"world!\"}", response.Body.String())
+		},
+	})
+
+	// The size limit applies to the decompressed body
+	tryAuthorizedPost("/data/foo", AuthorizedBodyConfig{
+		Body:    compress("[" + strings.Repeat("0,", 100_000) + "0]"),
+		Token:   token,
+		Headers: map[string]string{"Content-Encoding": "gzip"},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusRequestEntityTooLarge, response.Code)
+		},
+	})
+
+	for encoding, status := range map[string]int{"gzip": http.StatusBadRequest, "deflate": http.StatusUnsupportedMediaType} {
+		tryAuthorizedPost("/data/foo", AuthorizedBodyConfig{
+			Body:    "{\"hello\": \"world!\"}",
+			Token:   token,
+			Headers: map[string]string{"Content-Encoding": encoding},
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, status, response.Code, encoding)
+			},
+		})
+	}
+}
+
+func TestBinaryEncodings(t *testing.T) {
+	token := loginUser(t)
+	value := map[string]any{"hello": "world!", "count": int64(3), "ratio": 0.5, "list": []any{true, nil}}
+
+	encoded := map[string][]byte{}
+	encoded["application/cbor"], _ = cbor.Marshal(value)
+	encoded["application/msgpack"], _ = msgpack.Marshal(value)
+
+	for contentType, body := range encoded {
+		tryAuthorizedPost("/data/foo", AuthorizedBodyConfig{
+			Body:    string(body),
+			Token:   token,
+			Headers: map[string]string{"Content-Type": contentType},
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code, contentType)
+			},
+		})
+
+		tryAuthorizedGet("/data/foo", AuthorizedConfig{
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+				assert.Equal(t, "{\"count\":3,\"hello\":\"world!\",\"list\":[true,null],\"ratio\":0.5}", response.Body.String())
+			},
+		})
+
+		tryAuthorizedGet("/data/foo", AuthorizedConfig{
+			Token:   token,
+			Headers: map[string]string{"Accept": "application/json;q=0.5, " + contentType},
+			Handler: func(response *httptest.ResponseRecorder) {
+				var decoded map[string]any
+
+				assert.Equal(t, http.StatusOK, response.Code)
+				assert.Equal(t, contentType, response.Header().Get("Content-Type"))
+
+				if contentType == "application/cbor" {
+					assert.NoError(t, cbor.Unmarshal(response.Body.Bytes(), &decoded))
+					assert.Equal(t, uint64(3), decoded["count"])
+				} else {
+					assert.NoError(t, msgpack.Unmarshal(response.Body.Bytes(), &decoded))
+					assert.Equal(t, int8(3), decoded["count"])
+				}
+
+				assert.Equal(t, "world!", decoded["hello"])
+				assert.Equal(t, 0.5, decoded["ratio"])
+				assert.Equal(t, []any{true, nil}, decoded["list"])
+			},
+		})
+
+		// Responses to HEAD requests announce the negotiated encoding without a length
+		tryRequest("/data/foo", "HEAD", "", AuthorizedConfig{
+			Token:   token,
+			Headers: map[string]string{"Accept": contentType},
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+				assert.Equal(t, contentType, response.Header().Get("Content-Type"))
+				assert.Empty(t, response.Header().Get("Content-Length"))
+				assert.Empty(t, response.Body.String())
+			},
+		})
+
+		// The size limit applies to the data as JSON
+		large, _ := cbor.Marshal(slices.Repeat([]any{0.5}, 300))
+		if contentType == "application/msgpack" {
+			large, _ = msgpack.Marshal(slices.Repeat([]any{0.5}, 300))
+		}
+
+		tryAuthorizedPost("/data/foo", AuthorizedBodyConfig{
+			Body:    string(large),
+			Token:   token,
+			Headers: map[string]string{"Content-Type": contentType},
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusRequestEntityTooLarge, response.Code, contentType)
+			},
+		})
+
+		tryAuthorizedPost("/data/foo", AuthorizedBodyConfig{
+			Body:    "\xc1",
+			Token:   token,
+			Headers: map[string]string{"Content-Type": contentType},
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, response.Code, contentType)
+			},
+		})
+	}
+
+	// Errors are converted as well
+	tryAuthorizedGet("/data/f$o", AuthorizedConfig{
+		Token:   token,
+		Headers: map[string]string{"Accept": "application/cbor"},
+		Handler: func(response *httptest.ResponseRecorder) {
+			var decoded map[string]any
+
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+			assert.Equal(t, "application/cbor", response.Header().Get("Content-Type"))
+			assert.NoError(t, cbor.Unmarshal(response.Body.Bytes(), &decoded))
+			assert.Contains(t, decoded, "error")
+		},
+	})
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token:   token,
+		Headers: map[string]string{"Accept": "text/html, */*;q=0.8"},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "application/json; charset=utf-8", response.Header().Get("Content-Type"))
+		},
+	})
+}
+
+func TestConditionalRequests(t *testing.T) {
+	token := loginUser(t)
+	var etag, modified, collection string
+
+	tryAuthorizedPost("/data/foo", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"world\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/foo", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "private, no-cache", response.Header().Get("Cache-Control"))
+			etag = response.Header().Get("ETag")
+			modified = response.Header().Get("Last-Modified")
+		},
+	})
+
+	_, err := http.ParseTime(modified)
+	assert.NoError(t, err)
+
+	for _, headers := range []map[string]string{
+		{"If-None-Match": etag},
+		{"If-None-Match": "\"5\", W/" + etag},
+		{"If-None-Match": "*"},
+		{"If-Modified-Since": modified},
+		{"If-Modified-Since": time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)},
+	} {
+		tryAuthorizedGet("/data/foo", AuthorizedConfig{
+			Token:   token,
+			Headers: headers,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusNotModified, response.Code)
+				assert.Empty(t, response.Body.String())
+				assert.Equal(t, etag, response.Header().Get("ETag"))
+			},
+		})
+	}
+
+	for _, headers := range []map[string]string{
+		{"If-None-Match": "\"5\""},
+		{"If-None-Match": "\"5\"", "If-Modified-Since": modified},
+		{"If-Modified-Since": time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)},
+	} {
+		tryAuthorizedGet("/data/foo", AuthorizedConfig{
+			Token:   token,
+			Headers: headers,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+				assert.Equal(t, "{\"hello\":\"world\"}", response.Body.String())
+			},
+		})
+	}
+
+	tryRequest("/data/foo", "HEAD", "", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Empty(t, response.Body.String())
+			assert.Equal(t, etag, response.Header().Get("ETag"))
+			assert.Equal(t, "17", response.Header().Get("Content-Length"))
+		},
+	})
+
+	tryRequest("/data/missing", "HEAD", "", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNoContent, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			collection = response.Header().Get("ETag")
+		},
+	})
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token:   token,
+		Headers: map[string]string{"If-None-Match": collection},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotModified, response.Code)
+		},
+	})
+
+	// Any change invalidates cached copies
+	tryAuthorizedPost("/data/foo", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"moon\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/foo", AuthorizedConfig{
+		Token:   token,
+		Headers: map[string]string{"If-None-Match": etag},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data", AuthorizedConfig{
+		Token:   token,
+		Headers: map[string]string{"If-None-Match": collection},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NotEqual(t, collection, response.Header().Get("ETag"))
+		},
+	})
+
+	// Recreated keys don't match cached copies of the deleted value
+	tryAuthorizedGet("/data/foo", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			etag = response.Header().Get("ETag")
+		},
+	})
+
+	tryAuthorizedDelete("/data/foo", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/foo", AuthorizedBodyConfig{
+		Body:  "{\"hello\": \"sun\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NotEqual(t, etag, response.Header().Get("ETag"))
+		},
+	})
+
+	tryAuthorizedGet("/data/foo", AuthorizedConfig{
+		Token:   token,
+		Headers: map[string]string{"If-None-Match": etag},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"hello\":\"sun\"}", response.Body.String())
+		},
+	})
+}
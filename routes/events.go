@@ -0,0 +1,90 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"go.uber.org/zap"
+)
+
+// eventsKeepAlive is the interval of comments sent to keep idle connections open.
+const eventsKeepAlive = 30 * time.Second
+
+func DataEvents(c *gin.Context) {
+	user := authenticateUser(c)
+	lastID, err := parseLastEventID(c)
+
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid Last-Event-ID"})
+		return
+	}
+
+	events, missed, cancel, err := core.SubscribeEvents(user.Name, lastID)
+	defer cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// The client has to fetch all data again as it missed some changes
+	if errors.Is(err, core.ErrEventsLost) {
+		fmt.Fprint(c.Writer, "event: resync\ndata: {}\n\n")
+	}
+
+	values := c.Query("values") == "true"
+	for _, event := range missed {
+		writeEvent(c.Writer, event, values)
+	}
+
+	c.Writer.Flush()
+	ticker := time.NewTicker(eventsKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(c.Writer, ": keep-alive\n\n")
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			writeEvent(c.Writer, event, values)
+		}
+
+		c.Writer.Flush()
+	}
+}
+
+func writeEvent(w io.Writer, event core.DataEvent, values bool) {
+	if !values {
+		event.Value = nil
+	}
+
+	if data, err := json.Marshal(event); err != nil {
+		core.Logger.Error("failed to encode event", zap.Error(err))
+	} else {
+		fmt.Fprintf(w, "id: %d\ndata: %s\n\n", event.ID, data)
+	}
+}
+
+func parseLastEventID(c *gin.Context) (uint64, error) {
+	if header := c.GetHeader("Last-Event-ID"); header == "" {
+		return 0, nil
+	} else {
+		return strconv.ParseUint(header, 10, 64)
+	}
+}
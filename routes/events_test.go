@@ -0,0 +1,97 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// streamEvents collects the events sent while the given writes are applied.
+func streamEvents(url string, config AuthorizedConfig, writes func()) *httptest.ResponseRecorder {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan *httptest.ResponseRecorder)
+
+	config.Context = ctx
+	config.Handler = func(response *httptest.ResponseRecorder) {
+		done <- response
+	}
+
+	go tryAuthorizedGet(url, config)
+
+	// Give the stream some time to subscribe
+	time.Sleep(100 * time.Millisecond)
+	writes()
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	return <-done
+}
+
+func TestDataEvents(t *testing.T) {
+	token := loginUser(t)
+
+	tryUnauthorizedGet("/data/_events", UnauthorizedConfig{
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnauthorized, response.Code)
+		},
+	})
+
+	response := streamEvents("/data/_events?values=true", AuthorizedConfig{Token: token}, func() {
+		tryAuthorizedPost("/data/foo", AuthorizedBodyConfig{
+			Body:    "{\"hello\": \"world!\"}",
+			Token:   token,
+			Handler: func(*httptest.ResponseRecorder) {},
+		})
+
+		tryAuthorizedPatch("/data/foo", AuthorizedBodyConfig{
+			Body:    "{\"hello\": \"there!\"}",
+			Token:   token,
+			Headers: mergePatchHeaders,
+			Handler: func(*httptest.ResponseRecorder) {},
+		})
+
+		tryAuthorizedDelete("/data/foo", AuthorizedConfig{
+			Token:   token,
+			Handler: func(*httptest.ResponseRecorder) {},
+		})
+
+		tryAuthorizedDelete("/data/bar", AuthorizedConfig{
+			Token:   token,
+			Handler: func(*httptest.ResponseRecorder) {},
+		})
+	})
+
+	ids := regexp.MustCompile(`id: (\d+)`).FindAllStringSubmatch(response.Body.String(), -1)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "text/event-stream", response.Header().Get("Content-Type"))
+	assert.Len(t, ids, 3)
+	assert.Equal(t, ""+
+		"id: "+ids[0][1]+"\ndata: {\"operation\":\"set\",\"key\":\"foo\",\"revision\":1,\"value\":{\"hello\":\"world!\"}}\n\n"+
+		"id: "+ids[1][1]+"\ndata: {\"operation\":\"set\",\"key\":\"foo\",\"revision\":2,\"value\":{\"hello\":\"there!\"}}\n\n"+
+		"id: "+ids[2][1]+"\ndata: {\"operation\":\"delete\",\"key\":\"foo\",\"revision\":2}\n\n",
+		response.Body.String())
+
+	// Resume after the first event
+	response = streamEvents("/data/_events", AuthorizedConfig{Token: token, Headers: map[string]string{"Last-Event-ID": ids[0][1]}}, func() {})
+	assert.Equal(t, ""+
+		"id: "+ids[1][1]+"\ndata: {\"operation\":\"set\",\"key\":\"foo\",\"revision\":2}\n\n"+
+		"id: "+ids[2][1]+"\ndata: {\"operation\":\"delete\",\"key\":\"foo\",\"revision\":2}\n\n",
+		response.Body.String())
+
+	// Events from before the server started are gone
+	response = streamEvents("/data/_events", AuthorizedConfig{Token: token, Headers: map[string]string{"Last-Event-ID": "1"}}, func() {})
+	assert.Equal(t, "event: resync\ndata: {}\n\n", response.Body.String())
+
+	tryAuthorizedGet("/data/_events", AuthorizedConfig{
+		Token:   token,
+		Headers: map[string]string{"Last-Event-ID": "abc"},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+}
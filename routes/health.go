@@ -2,11 +2,18 @@ package routes
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
 	"net/http"
 )
 
 func Health(c *gin.Context) {
 
 	// We assume, if the api is able to respond to this request, it is healthy.
-	c.Status(http.StatusOK)
+	if core.Config.AppBackupInterval <= 0 {
+		c.Status(http.StatusOK)
+	} else if last := core.LastBackup(); last.IsZero() {
+		c.JSON(http.StatusOK, gin.H{"lastBackup": nil})
+	} else {
+		c.JSON(http.StatusOK, gin.H{"lastBackup": last})
+	}
 }
@@ -0,0 +1,81 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"go.uber.org/zap"
+)
+
+func DataHistory(c *gin.Context) {
+	key := c.Param("key")
+	user := authenticateUser(c)
+
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	} else if !core.Config.AppKeyPattern.MatchString(key) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key must match " + core.Config.AppKeyPattern.String()})
+	} else if list, err := core.GetDataHistory(user.Name, key); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve history"})
+		core.Logger.Error("failed to retrieve history", zap.Error(err))
+	} else {
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+func DataVersion(c *gin.Context) {
+	key := c.Param("key")
+	user := authenticateUser(c)
+
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	} else if !core.Config.AppKeyPattern.MatchString(key) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key must match " + core.Config.AppKeyPattern.String()})
+	} else if revision, err := strconv.ParseUint(c.Param("rev"), 10, 64); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid revision"})
+	} else if data, _, err := core.GetDataVersion(user.Name, key, revision); err != nil {
+		if errors.Is(err, core.ErrKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve revision"})
+			core.Logger.Error("failed to retrieve revision", zap.Error(err))
+		}
+	} else {
+		c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+	}
+}
+
+func RestoreData(c *gin.Context) {
+	key := c.Param("key")
+	user := authenticateUser(c)
+
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	} else if !core.Config.AppKeyPattern.MatchString(key) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key must match " + core.Config.AppKeyPattern.String()})
+	} else if revision, err := strconv.ParseUint(c.Param("rev"), 10, 64); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid revision"})
+	} else if meta, err := core.RestoreDataVersion(user.Name, key, revision, core.WriteOptions{Precondition: ifMatch(c)}); err != nil {
+		if errors.Is(err, core.ErrKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "revision not found"})
+		} else if errors.Is(err, core.ErrPreconditionFailed) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "revision does not match"})
+		} else if errors.Is(err, core.ErrQuotaExceeded) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "storage quota exceeded, limit is " + strconv.FormatInt(core.Config.AppQuotaPerUser, 10) + " bytes"})
+		} else if schemaErr := asSchemaError(err); schemaErr != nil {
+			schemaViolation(c, schemaErr)
+		} else if errors.Is(err, core.ErrConflict) {
+			retryLater(c)
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore revision"})
+			core.Logger.Error("failed to restore revision", zap.Error(err))
+		}
+	} else {
+		setQuotaHeaders(c, user.Name)
+		c.Header("ETag", formatETag(meta))
+		c.Status(http.StatusOK)
+	}
+}
@@ -0,0 +1,115 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/simonwep/genesis/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func getHistory(t *testing.T, token, key string) []core.DataMeta {
+	var list []core.DataMeta
+
+	tryAuthorizedGet("/data/"+key+"/history", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &list))
+		},
+	})
+
+	return list
+}
+
+func TestHistory(t *testing.T) {
+	token := loginUser(t)
+
+	for _, body := range []string{"{\"v\":1}", "{\"v\":2}", "{\"v\":3}", "{\"v\":4}"} {
+		tryAuthorizedPost("/data/bar", AuthorizedBodyConfig{
+			Body:  body,
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	history := getHistory(t, token, "bar")
+	assert.Len(t, history, 2)
+	assert.Equal(t, uint64(3), history[0].Revision)
+	assert.Equal(t, uint64(2), history[1].Revision)
+	assert.Equal(t, int64(7), history[0].Size)
+
+	tryAuthorizedGet("/data/bar/history/2", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"v\":2}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedGet("/data/bar/history/1", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/bar/restore/2", AuthorizedBodyConfig{
+		Token:   token,
+		Headers: map[string]string{"If-Match": "\"3\""},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusPreconditionFailed, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/bar/restore/2", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "\"5\"", response.Header().Get("ETag"))
+		},
+	})
+
+	tryAuthorizedGet("/data/bar", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"v\":2}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedDelete("/data/bar", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	assert.Empty(t, getHistory(t, token, "bar"))
+}
+
+func TestHistorySizeBudget(t *testing.T) {
+	token := loginUser(t)
+
+	body := "[" + strings.Repeat("1,", 299) + "1]"
+	for _, key := range []string{"foo", "bar"} {
+		for i := 0; i < 2; i++ {
+			tryAuthorizedPost("/data/"+key, AuthorizedBodyConfig{
+				Body:  body,
+				Token: token,
+				Handler: func(response *httptest.ResponseRecorder) {
+					assert.Equal(t, http.StatusOK, response.Code)
+				},
+			})
+		}
+	}
+
+	// only the latest version fits into the budget
+	assert.Empty(t, getHistory(t, token, "foo"))
+	assert.Len(t, getHistory(t, token, "bar"), 1)
+}
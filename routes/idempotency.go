@@ -0,0 +1,126 @@
+package routes
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"go.uber.org/zap"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+	idempotencyKeyMaxLength   = 255
+)
+
+// Headers which depend on how the response has been transferred and are not replayed
+var idempotencyIgnoredHeaders = []string{"Content-Encoding", "Content-Length", "Vary"}
+
+// Idempotent stores the response of the first successful request of a user with an Idempotency-Key header
+// and replays it for retries. It has to be the last middleware before the handler to see the final body.
+func Idempotent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		// Unauthenticated requests are rejected by the handler
+		user := authenticateUser(c)
+		if user == nil {
+			c.Next()
+			return
+		}
+
+		if len(key) > idempotencyKeyMaxLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "idempotency key too long"})
+			return
+		}
+
+		release, err := core.LockIdempotencyKey(user.Name, key)
+		if errors.Is(err, core.ErrIdempotencyKeyInUse) {
+			c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "a request with this idempotency key is in progress"})
+			return
+		}
+
+		defer release()
+
+		// Errors, e.g. a body exceeding the size limit, are passed on to the handler
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), &errorReader{err: err}))
+			c.Next()
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		hash := core.HashRequest([]byte(c.Request.Method), []byte(c.Request.URL.RequestURI()), body)
+
+		if stored, err := core.GetIdempotentResponse(user.Name, key); err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+			core.Logger.Error("failed to retrieve idempotent response", zap.Error(err))
+		} else if stored != nil && stored.Hash != hash {
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "idempotency key has already been used for a different request"})
+		} else if stored != nil {
+			for name, values := range stored.Header {
+				c.Writer.Header()[name] = values
+			}
+
+			c.Header(idempotencyReplayedHeader, "true")
+			c.Status(stored.Status)
+			_, _ = c.Writer.Write(stored.Body)
+			c.Abort()
+		} else {
+			writer := &recordWriter{ResponseWriter: c.Writer}
+			c.Writer = writer
+			c.Next()
+			c.Writer = writer.ResponseWriter
+
+			if status := writer.Status(); status < 200 || status > 299 {
+				return
+			}
+
+			header := c.Writer.Header().Clone()
+			for _, name := range idempotencyIgnoredHeaders {
+				header.Del(name)
+			}
+
+			if err := core.StoreIdempotentResponse(user.Name, key, &core.IdempotentResponse{
+				Hash:   hash,
+				Status: writer.Status(),
+				Header: header,
+				Body:   writer.body.Bytes(),
+			}); err != nil {
+				core.Logger.Error("failed to store idempotent response", zap.Error(err))
+			}
+		}
+	}
+}
+
+// recordWriter keeps a copy of the response body.
+type recordWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+type errorReader struct {
+	err error
+}
+
+func (r *errorReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,127 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotentData(t *testing.T) {
+	token := loginUser(t)
+	var etag string
+
+	tryAuthorizedPost("/data/foo", AuthorizedBodyConfig{
+		Body:    "{\"hello\": \"world\"}",
+		Token:   token,
+		Headers: map[string]string{"Idempotency-Key": "abc"},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Empty(t, response.Header().Get("Idempotent-Replayed"))
+			etag = response.Header().Get("ETag")
+		},
+	})
+
+	// The retry is replayed and doesn't create a new revision
+	tryAuthorizedPost("/data/foo", AuthorizedBodyConfig{
+		Body:    "{\"hello\":\"world\"}",
+		Token:   token,
+		Headers: map[string]string{"Idempotency-Key": "abc"},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "true", response.Header().Get("Idempotent-Replayed"))
+			assert.Equal(t, etag, response.Header().Get("ETag"))
+		},
+	})
+
+	tryAuthorizedGet("/data/foo", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, etag, response.Header().Get("ETag"))
+		},
+	})
+
+	// Reusing the key for a different request is rejected
+	tryAuthorizedPost("/data/foo", AuthorizedBodyConfig{
+		Body:    "{\"hello\": \"moon\"}",
+		Token:   token,
+		Headers: map[string]string{"Idempotency-Key": "abc"},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/bar", AuthorizedBodyConfig{
+		Body:    "{\"hello\": \"world\"}",
+		Token:   token,
+		Headers: map[string]string{"Idempotency-Key": "abc"},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+		},
+	})
+
+	// Failed requests aren't stored
+	tryAuthorizedPost("/data/baz", AuthorizedBodyConfig{
+		Body:    "{\"hello\": ",
+		Token:   token,
+		Headers: map[string]string{"Idempotency-Key": "def"},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/baz", AuthorizedBodyConfig{
+		Body:    "{\"hello\": \"world\"}",
+		Token:   token,
+		Headers: map[string]string{"Idempotency-Key": "def"},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Empty(t, response.Header().Get("Idempotent-Replayed"))
+		},
+	})
+
+	tryAuthorizedPost("/data/baz", AuthorizedBodyConfig{
+		Body:    "{}",
+		Token:   token,
+		Headers: map[string]string{"Idempotency-Key": strings.Repeat("a", 256)},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+}
+
+func TestIdempotentUserCreation(t *testing.T) {
+	token := loginAdmin(t)
+	body := "{\"name\":\"test2\",\"password\":\"foobar1235\",\"admin\":false}"
+
+	for range 2 {
+		tryAuthorizedPost("/user", AuthorizedBodyConfig{
+			Token:   token,
+			Body:    body,
+			Headers: map[string]string{"Idempotency-Key": "create-test2"},
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusCreated, response.Code)
+				assert.Equal(t, "{\"message\":\"user created\"}", response.Body.String())
+			},
+		})
+	}
+
+	tryAuthorizedPost("/user", AuthorizedBodyConfig{
+		Token: token,
+		Body:  body,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusConflict, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/user", AuthorizedBodyConfig{
+		Token:   token,
+		Body:    "{\"name\":\"test3\",\"password\":\"foobar1235\",\"admin\":false}",
+		Headers: map[string]string{"Idempotency-Key": "create-test2"},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+		},
+	})
+}
@@ -0,0 +1,127 @@
+package routes
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"github.com/simonwep/genesis/middleware"
+	"go.uber.org/zap"
+)
+
+const (
+	mergePatchContentType = "application/merge-patch+json"
+	jsonPatchContentType  = "application/json-patch+json"
+)
+
+var (
+	errDataTooLarge = errors.New("data too large")
+	errPatchFailed  = errors.New("failed to apply patch")
+)
+
+func PatchData(c *gin.Context) {
+	key := c.Param("key")
+	user := authenticateUser(c)
+
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	} else if !core.Config.AppKeyPattern.MatchString(key) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key must match " + core.Config.AppKeyPattern.String()})
+	} else if c.ContentType() != mergePatchContentType && c.ContentType() != jsonPatchContentType {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "content type must be " + mergePatchContentType + " or " + jsonPatchContentType})
+	} else if body, err := c.GetRawData(); err != nil {
+		if isMaxBytesError(err) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request entity too large, limit is " + strconv.FormatInt(core.Config.AppDataMaxSize, 10) + " kilobytes"})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body"})
+		}
+	} else if !json.Valid(body) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "body must be valid JSON"})
+	} else if patch, err := parsePatch(c.ContentType(), body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid patch"})
+	} else if meta, err := core.UpdateDataForUser(user.Name, key, patch, core.WriteOptions{Precondition: ifMatch(c)}); err != nil {
+		if errors.Is(err, core.ErrKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "key not found"})
+		} else if errors.Is(err, core.ErrPreconditionFailed) {
+			c.JSON(http.StatusPreconditionFailed, gin.H{"error": "revision does not match"})
+		} else if errors.Is(err, jsonpatch.ErrTestFailed) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		} else if errors.Is(err, errPatchFailed) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		} else if errors.Is(err, core.ErrQuotaExceeded) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "storage quota exceeded, limit is " + strconv.FormatInt(core.Config.AppQuotaPerUser, 10) + " bytes"})
+		} else if errors.Is(err, errDataTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "patched data too large, limit is " + strconv.FormatInt(core.Config.AppDataMaxSize, 10) + " kilobytes"})
+		} else if schemaErr := asSchemaError(err); schemaErr != nil {
+			schemaViolation(c, schemaErr)
+		} else if errors.Is(err, core.ErrConflict) {
+			retryLater(c)
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to patch data"})
+			core.Logger.Error("failed to patch data", zap.Error(err))
+		}
+	} else {
+		setQuotaHeaders(c, user.Name)
+		c.Header("ETag", formatETag(meta))
+		c.Status(http.StatusOK)
+	}
+}
+
+// parsePatch returns a function applying the given patch of contentType to a document.
+func parsePatch(contentType string, body []byte) (func([]byte) ([]byte, error), error) {
+	if contentType == mergePatchContentType {
+		return mergePatch(body), nil
+	}
+
+	patch, err := jsonpatch.DecodePatch(body)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(current []byte) ([]byte, error) {
+		if patched, err := patch.Apply(current); err != nil {
+			return nil, fmt.Errorf("%w: %w", errPatchFailed, err)
+		} else {
+			return normalizeData(patched)
+		}
+	}, nil
+}
+
+// mergePatch returns a function applying patch as JSON Merge Patch (RFC 7396).
+// Patches which aren't objects replace the document, objects are merged into an empty one if it isn't an object.
+func mergePatch(patch []byte) func([]byte) ([]byte, error) {
+	return func(current []byte) ([]byte, error) {
+		if !isJsonObject(patch) {
+			return normalizeData(patch)
+		} else if !isJsonObject(current) {
+			current = []byte("{}")
+		}
+
+		if merged, err := jsonpatch.MergePatch(current, patch); err != nil {
+			return nil, fmt.Errorf("%w: %w", errPatchFailed, err)
+		} else {
+			return normalizeData(merged)
+		}
+	}
+}
+
+func isJsonObject(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+}
+
+// normalizeData minifies and validates data created by the server the same way request bodies are.
+func normalizeData(data []byte) ([]byte, error) {
+	if minified, err := middleware.MinifyJsonBytes(data); err != nil {
+		return nil, err
+	} else if int64(len(minified)) > core.Config.AppDataMaxSize {
+		return nil, errDataTooLarge
+	} else {
+		return minified, nil
+	}
+}
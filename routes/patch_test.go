@@ -0,0 +1,197 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var mergePatchHeaders = map[string]string{"Content-Type": "application/merge-patch+json"}
+
+func TestMergePatch(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedPatch("/data/bar", AuthorizedBodyConfig{
+		Body:    "{\"a\": 2}",
+		Token:   token,
+		Headers: mergePatchHeaders,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/bar", AuthorizedBodyConfig{
+		Body:  "{\"a\": 1, \"b\": {\"c\": 2, \"d\": 3}}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPatch("/data/bar", AuthorizedBodyConfig{
+		Body:  "{\"a\": 2}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnsupportedMediaType, response.Code)
+		},
+	})
+
+	tryAuthorizedPatch("/data/bar", AuthorizedBodyConfig{
+		Body:    "{\"b\": {\"c\": null, \"e\": 5}, \"f\": [1, 2]}",
+		Token:   token,
+		Headers: mergePatchHeaders,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "\"2\"", response.Header().Get("ETag"))
+		},
+	})
+
+	tryAuthorizedGet("/data/bar", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"a\":1,\"b\":{\"d\":3,\"e\":5},\"f\":[1,2]}", response.Body.String())
+		},
+	})
+
+	tryAuthorizedPatch("/data/bar", AuthorizedBodyConfig{
+		Body:    "{\"a\": 3}",
+		Token:   token,
+		Headers: map[string]string{"Content-Type": "application/merge-patch+json", "If-Match": "\"1\""},
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusPreconditionFailed, response.Code)
+		},
+	})
+
+	// Patches which aren't objects replace the value, objects are merged into an empty one if the value isn't an object
+	for _, patch := range [][2]string{
+		{"[1, 2]", "[1,2]"},
+		{"{\"a\": {\"b\": null, \"c\": 1}}", "{\"a\":{\"c\":1}}"},
+		{"\"text\"", "\"text\""},
+		{"null", "null"},
+	} {
+		tryAuthorizedPatch("/data/bar", AuthorizedBodyConfig{
+			Body:    patch[0],
+			Token:   token,
+			Headers: mergePatchHeaders,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code, patch[0])
+			},
+		})
+
+		tryAuthorizedGet("/data/bar", AuthorizedConfig{
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, patch[1], response.Body.String())
+			},
+		})
+	}
+}
+
+func TestMergePatchTooBig(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedPost("/data/bar", AuthorizedBodyConfig{
+		Body:  "{\"a\": \"" + strings.Repeat("a", 600) + "\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPatch("/data/bar", AuthorizedBodyConfig{
+		Body:    "{\"b\": \"" + strings.Repeat("b", 600) + "\"}",
+		Token:   token,
+		Headers: mergePatchHeaders,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusRequestEntityTooLarge, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/bar", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "\"1\"", response.Header().Get("ETag"))
+		},
+	})
+}
+
+var jsonPatchHeaders = map[string]string{"Content-Type": "application/json-patch+json"}
+
+func TestJsonPatch(t *testing.T) {
+	token := loginUser(t)
+
+	tryAuthorizedPost("/data/bar", AuthorizedBodyConfig{
+		Body:  "{\"a\": 1, \"b\": [1, 2], \"c\": {\"d\": true}}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPatch("/data/bar", AuthorizedBodyConfig{
+		Body: `[
+			{"op": "test", "path": "/a", "value": 1},
+			{"op": "replace", "path": "/a", "value": 2},
+			{"op": "add", "path": "/b/-", "value": 3},
+			{"op": "remove", "path": "/b/0"},
+			{"op": "copy", "from": "/c", "path": "/e"},
+			{"op": "move", "from": "/c/d", "path": "/f"}
+		]`,
+		Token:   token,
+		Headers: jsonPatchHeaders,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "\"2\"", response.Header().Get("ETag"))
+		},
+	})
+
+	tryAuthorizedGet("/data/bar", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"a\":2,\"b\":[2,3],\"c\":{},\"e\":{\"d\":true},\"f\":true}", response.Body.String())
+		},
+	})
+
+	// failing test leaves the data untouched
+	tryAuthorizedPatch("/data/bar", AuthorizedBodyConfig{
+		Body:    `[{"op": "replace", "path": "/a", "value": 3}, {"op": "test", "path": "/a", "value": 1}]`,
+		Token:   token,
+		Headers: jsonPatchHeaders,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusConflict, response.Code)
+		},
+	})
+
+	tryAuthorizedPatch("/data/bar", AuthorizedBodyConfig{
+		Body:    `[{"op": "remove", "path": "/missing"}]`,
+		Token:   token,
+		Headers: jsonPatchHeaders,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+		},
+	})
+
+	tryAuthorizedPatch("/data/bar", AuthorizedBodyConfig{
+		Body:    `{"op": "remove", "path": "/a"}`,
+		Token:   token,
+		Headers: jsonPatchHeaders,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusBadRequest, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/bar", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "\"2\"", response.Header().Get("ETag"))
+			assert.Equal(t, "{\"a\":2,\"b\":[2,3],\"c\":{},\"e\":{\"d\":true},\"f\":true}", response.Body.String())
+		},
+	})
+}
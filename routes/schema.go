@@ -0,0 +1,86 @@
+package routes
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"go.uber.org/zap"
+)
+
+type schemaBody struct {
+	Key     string          `json:"key"`
+	Pattern string          `json:"pattern"`
+	Schema  json.RawMessage `json:"schema"`
+}
+
+func GetSchemas(c *gin.Context) {
+	user := authenticateUser(c)
+
+	if user == nil || !user.Admin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+	} else if schemas, err := core.GetSchemas(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve schemas"})
+		core.Logger.Error("failed to retrieve schemas", zap.Error(err))
+	} else {
+		c.JSON(http.StatusOK, schemas)
+	}
+}
+
+func SetSchema(c *gin.Context) {
+	user := authenticateUser(c)
+	var body schemaBody
+
+	if user == nil || !user.Admin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+	} else if err := c.ShouldBindJSON(&body); err != nil || len(body.Schema) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json, must contain schema and either key or pattern"})
+	} else if err := core.SetSchema(core.Schema{
+		Name:    c.Param("name"),
+		Key:     body.Key,
+		Pattern: body.Pattern,
+		Schema:  body.Schema,
+	}); err != nil {
+		if errors.Is(err, core.ErrInvalidSchema) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to set schema"})
+			core.Logger.Error("failed to set schema", zap.Error(err))
+		}
+	} else {
+		c.Status(http.StatusOK)
+	}
+}
+
+func DeleteSchema(c *gin.Context) {
+	user := authenticateUser(c)
+
+	if user == nil || !user.Admin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+	} else if err := core.DeleteSchema(c.Param("name")); err != nil {
+		if errors.Is(err, core.ErrSchemaNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "schema not found"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete schema"})
+			core.Logger.Error("failed to delete schema", zap.Error(err))
+		}
+	} else {
+		c.Status(http.StatusOK)
+	}
+}
+
+// asSchemaError returns the schema violations of a failed write, if there are any.
+func asSchemaError(err error) *core.SchemaError {
+	var schemaErr *core.SchemaError
+	if errors.As(err, &schemaErr) {
+		return schemaErr
+	}
+
+	return nil
+}
+
+func schemaViolation(c *gin.Context, schemaErr *core.SchemaError) {
+	c.JSON(http.StatusUnprocessableEntity, gin.H{"error": schemaErr.Error(), "violations": schemaErr.Violations})
+}
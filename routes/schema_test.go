@@ -0,0 +1,156 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/simonwep/genesis/core"
+	"github.com/stretchr/testify/assert"
+)
+
+const settingsSchema = `{
+	"type": "object",
+	"properties": {
+		"theme": {"enum": ["light", "dark"]},
+		"size": {"type": "integer", "minimum": 1}
+	},
+	"required": ["theme"]
+}`
+
+func TestSchemaManagement(t *testing.T) {
+	admin := loginAdmin(t)
+	token := loginUser(t)
+
+	tryAuthorizedPost("/schema/settings", AuthorizedBodyConfig{
+		Body:  "{\"key\": \"settings\", \"schema\": " + settingsSchema + "}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	for _, body := range []string{
+		"{\"schema\": " + settingsSchema + "}",
+		"{\"key\": \"settings\", \"pattern\": \"set.*\", \"schema\": " + settingsSchema + "}",
+		"{\"pattern\": \"(\", \"schema\": " + settingsSchema + "}",
+		"{\"key\": \"settings\", \"schema\": {\"type\": 5}}",
+		"{\"key\": \"settings\", \"schema\": {\"$ref\": \"file:///etc/passwd\"}}",
+		"{\"key\": \"settings\"}",
+	} {
+		tryAuthorizedPost("/schema/settings", AuthorizedBodyConfig{
+			Body:  body,
+			Token: admin,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusBadRequest, response.Code, body)
+			},
+		})
+	}
+
+	tryAuthorizedPost("/schema/settings", AuthorizedBodyConfig{
+		Body:  "{\"pattern\": \"settings|prefs_\\\\w+\", \"schema\": " + settingsSchema + "}",
+		Token: admin,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/schema", AuthorizedConfig{
+		Token: admin,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var schemas []core.Schema
+
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &schemas))
+			assert.Len(t, schemas, 1)
+			assert.Equal(t, "settings", schemas[0].Name)
+			assert.Equal(t, "settings|prefs_\\w+", schemas[0].Pattern)
+		},
+	})
+
+	tryAuthorizedDelete("/schema/settings", AuthorizedConfig{
+		Token: admin,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedDelete("/schema/settings", AuthorizedConfig{
+		Token: admin,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+		},
+	})
+}
+
+func TestSchemaValidation(t *testing.T) {
+	admin := loginAdmin(t)
+	token := loginUser(t)
+
+	tryAuthorizedPost("/schema/settings", AuthorizedBodyConfig{
+		Body:  "{\"pattern\": \"settings|prefs_\\\\w+\", \"schema\": " + settingsSchema + "}",
+		Token: admin,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/prefs_a", AuthorizedBodyConfig{
+		Body:  "{\"theme\": \"blue\", \"size\": 0}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			var body struct {
+				Violations []core.SchemaViolation `json:"violations"`
+			}
+
+			assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &body))
+			assert.ElementsMatch(t, []string{"/theme", "/size"}, []string{body.Violations[0].Path, body.Violations[1].Path})
+		},
+	})
+
+	// Keys only partially matching the pattern aren't validated
+	tryAuthorizedPost("/data/my_settings", AuthorizedBodyConfig{
+		Body:  "{\"theme\": \"blue\"}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/settings", AuthorizedBodyConfig{
+		Body:  "{\"theme\": \"dark\", \"size\": 2}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPatch("/data/settings", AuthorizedBodyConfig{
+		Body:    "{\"theme\": null}",
+		Token:   token,
+		Headers: mergePatchHeaders,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+			assert.Contains(t, response.Body.String(), "\"path\":\"\"")
+		},
+	})
+
+	tryAuthorizedPost("/data/_batch", AuthorizedBodyConfig{
+		Body:  "[{\"op\": \"set\", \"key\": \"settings\", \"value\": {\"theme\": \"light\"}}, {\"op\": \"set\", \"key\": \"prefs_b\", \"value\": []}]",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusUnprocessableEntity, response.Code)
+			assert.Contains(t, response.Body.String(), "\"violations\":[{\"path\":\"\"")
+		},
+	})
+
+	tryAuthorizedGet("/data/settings", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"theme\":\"dark\",\"size\":2}", response.Body.String())
+		},
+	})
+}
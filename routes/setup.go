@@ -16,6 +16,7 @@ func SetupRoutes() *gin.Engine {
 
 	// Middleware
 	root.Use(gin.Recovery())
+	root.Use(middleware.Compress())
 
 	// Wrap routes under common path
 	router := root.Group(core.Config.BaseUrl)
@@ -23,19 +24,47 @@ func SetupRoutes() *gin.Engine {
 	// Auth and account endpoints
 	router.POST("/login", Login)
 	router.POST("/account/update", UpdateAccount)
+	router.GET("/account/usage", AccountUsage)
 	router.POST("/logout", Logout)
 
 	// User endpoints
 	router.GET("/user", GetUser)
-	router.POST("/user", CreateUser)
+	router.POST("/user", Idempotent(), CreateUser)
 	router.POST("/user/:name", UpdateUser)
 	router.DELETE("/user/:name", DeleteUser)
 
-	// Data endpoints
-	router.POST("/data/:key", middleware.LimitBodySize(core.Config.AppDataMaxSize), middleware.MinifyJson(), SetData)
-	router.DELETE("/data/:key", DeleteData)
-	router.GET("/data/:key", DataByKey)
-	router.GET("/data", Data)
+	// Schema endpoints
+	router.GET("/schema", GetSchemas)
+	router.POST("/schema/:name", SetSchema)
+	router.DELETE("/schema/:name", DeleteSchema)
+
+	// Data endpoints, responses are converted to CBOR or MessagePack if requested
+	data := router.Group("/data", middleware.ConvertResponse())
+	data.POST("/:key", middleware.DecompressBody(), middleware.LimitBodySize(core.Config.AppDataMaxSize), middleware.ConvertBody(core.Config.AppDataMaxSize), middleware.MinifyJson(), Idempotent(), SetData)
+	data.PATCH("/:key", middleware.DecompressBody(), middleware.LimitBodySize(core.Config.AppDataMaxSize), Idempotent(), PatchData)
+	data.DELETE("/:key", DeleteData)
+	data.GET("/:key", DataByKey)
+	data.HEAD("/:key", DataByKey)
+	data.GET("", Data)
+	data.POST("/_batch", middleware.DecompressBody(), middleware.LimitBodySize(core.Config.AppBatchMaxSize), middleware.ConvertBody(core.Config.AppBatchMaxSize), middleware.MinifyJson(), Idempotent(), BatchData)
+	data.GET("/_events", DataEvents)
+
+	// History endpoints
+	data.GET("/:key/history", DataHistory)
+	data.GET("/:key/history/:rev", DataVersion)
+	data.POST("/:key/restore/:rev", RestoreData)
+
+	// Rename and copy endpoints
+	data.POST("/:key/rename", RenameData)
+	data.POST("/:key/copy", CopyData)
+
+	// Trash endpoints
+	data.GET("/_trash", Trash)
+	data.POST("/_trash/:key/restore", RestoreTrash)
+	data.DELETE("/_trash/:key", PurgeTrash)
+
+	// Admin endpoints
+	router.GET("/admin/backup", Backup)
 
 	// Heal check endpoints
 	router.GET("/health", Health)
@@ -0,0 +1,80 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/simonwep/genesis/core"
+	"go.uber.org/zap"
+)
+
+func Trash(c *gin.Context) {
+	user := authenticateUser(c)
+
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	} else if list, err := core.GetTrashForUser(user.Name); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to retrieve trash"})
+		core.Logger.Error("failed to retrieve trash", zap.Error(err))
+	} else {
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+func RestoreTrash(c *gin.Context) {
+	key := c.Param("key")
+	user := authenticateUser(c)
+
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	} else if !core.Config.AppKeyPattern.MatchString(key) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key must match " + core.Config.AppKeyPattern.String()})
+	} else if isReservedKey(key) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key " + key + " is reserved"})
+	} else if meta, err := core.RestoreTrashedData(user.Name, key, core.WriteOptions{}); err != nil {
+		if errors.Is(err, core.ErrKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "key not found in trash"})
+		} else if errors.Is(err, core.ErrKeyExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": "key already exists"})
+		} else if errors.Is(err, core.ErrTooManyKeys) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "too many keys, limit is " + strconv.FormatInt(core.Config.AppKeysPerUser, 10)})
+		} else if errors.Is(err, core.ErrQuotaExceeded) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "storage quota exceeded, limit is " + strconv.FormatInt(core.Config.AppQuotaPerUser, 10) + " bytes"})
+		} else if schemaErr := asSchemaError(err); schemaErr != nil {
+			schemaViolation(c, schemaErr)
+		} else if errors.Is(err, core.ErrConflict) {
+			retryLater(c)
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to restore data"})
+			core.Logger.Error("failed to restore data from trash", zap.Error(err))
+		}
+	} else {
+		setQuotaHeaders(c, user.Name)
+		c.Header("ETag", formatETag(meta))
+		c.Status(http.StatusOK)
+	}
+}
+
+func PurgeTrash(c *gin.Context) {
+	key := c.Param("key")
+	user := authenticateUser(c)
+
+	if user == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+	} else if !core.Config.AppKeyPattern.MatchString(key) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "key must match " + core.Config.AppKeyPattern.String()})
+	} else if err := core.PurgeTrashedData(user.Name, key); err != nil {
+		if errors.Is(err, core.ErrKeyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "key not found in trash"})
+		} else if errors.Is(err, core.ErrConflict) {
+			retryLater(c)
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to purge data"})
+			core.Logger.Error("failed to purge data from trash", zap.Error(err))
+		}
+	} else {
+		c.Status(http.StatusOK)
+	}
+}
@@ -0,0 +1,182 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/simonwep/genesis/core"
+	"github.com/stretchr/testify/assert"
+)
+
+func getTrash(t *testing.T, token string) []core.TrashedData {
+	var list []core.TrashedData
+
+	tryAuthorizedGet("/data/_trash", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.NoError(t, json.Unmarshal(response.Body.Bytes(), &list))
+		},
+	})
+
+	return list
+}
+
+func TestTrash(t *testing.T) {
+	token := loginUser(t)
+
+	for _, key := range []string{"a", "b", "c"} {
+		tryAuthorizedPost("/data/"+key, AuthorizedBodyConfig{
+			Body:  "{\"key\": \"" + key + "\"}",
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	tryAuthorizedDelete("/data/a", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	trash := getTrash(t, token)
+	assert.Len(t, trash, 1)
+	assert.Equal(t, "a", trash[0].Key)
+	assert.Equal(t, uint64(1), trash[0].Revision)
+	assert.True(t, trash[0].Purge.After(trash[0].Deleted))
+
+	// Trashed keys don't count towards the key limit
+	tryAuthorizedPost("/data/d", AuthorizedBodyConfig{
+		Body:  "{}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/_trash/a/restore", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusForbidden, response.Code)
+		},
+	})
+
+	tryAuthorizedDelete("/data/d", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/_trash/a/restore", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedGet("/data/a", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+			assert.Equal(t, "{\"key\":\"a\"}", response.Body.String())
+		},
+	})
+
+	trash = getTrash(t, token)
+	assert.Len(t, trash, 1)
+	assert.Equal(t, "d", trash[0].Key)
+
+	tryAuthorizedDelete("/data/c", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/c", AuthorizedBodyConfig{
+		Body:  "{}",
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	// Existing keys aren't overridden
+	tryAuthorizedPost("/data/_trash/c/restore", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusConflict, response.Code)
+		},
+	})
+
+	tryAuthorizedDelete("/data/_trash/c", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusOK, response.Code)
+		},
+	})
+
+	tryAuthorizedDelete("/data/_trash/c", AuthorizedConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+		},
+	})
+
+	tryAuthorizedPost("/data/_trash/c/restore", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+		},
+	})
+
+	trash = getTrash(t, token)
+	assert.Len(t, trash, 1)
+	assert.Equal(t, "d", trash[0].Key)
+}
+
+func TestTrashSize(t *testing.T) {
+	token := loginUser(t)
+	value := "\"" + strings.Repeat("x", 900) + "\""
+
+	for i := 0; i < 10; i++ {
+		key := "k" + strconv.Itoa(i)
+
+		tryAuthorizedPost("/data/"+key, AuthorizedBodyConfig{
+			Body:  value,
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+
+		tryAuthorizedDelete("/data/"+key, AuthorizedConfig{
+			Token: token,
+			Handler: func(response *httptest.ResponseRecorder) {
+				assert.Equal(t, http.StatusOK, response.Code)
+			},
+		})
+	}
+
+	// Only the latest deleted keys fit into the trash
+	trash := getTrash(t, token)
+	if assert.Len(t, trash, 2) {
+		assert.Equal(t, "k8", trash[0].Key)
+		assert.Equal(t, "k9", trash[1].Key)
+	}
+
+	tryAuthorizedPost("/data/_trash/k0/restore", AuthorizedBodyConfig{
+		Token: token,
+		Handler: func(response *httptest.ResponseRecorder) {
+			assert.Equal(t, http.StatusNotFound, response.Code)
+		},
+	})
+}
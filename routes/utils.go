@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
@@ -18,25 +19,37 @@ type UnauthorizedBodyConfig struct {
 
 type AuthorizedConfig struct {
 	Token   string
+	Headers map[string]string
+	Context context.Context
 	Handler func(*httptest.ResponseRecorder)
 }
 
 type AuthorizedBodyConfig struct {
 	Body    string
 	Token   string
+	Headers map[string]string
 	Handler func(*httptest.ResponseRecorder)
 }
 
 func tryRequest(url, method, body string, config AuthorizedConfig) {
 	router := SetupRoutes()
 
+	ctx := config.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
 	response := httptest.NewRecorder()
-	request, _ := http.NewRequest(method, url, strings.NewReader(body))
+	request, _ := http.NewRequestWithContext(ctx, method, url, strings.NewReader(body))
 
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set("Content-Length", strconv.FormatInt(int64(len(body)), 10))
 	request.Header.Set("Cookie", config.Token)
 
+	for key, value := range config.Headers {
+		request.Header.Set(key, value)
+	}
+
 	router.ServeHTTP(response, request)
 	config.Handler(response)
 }
@@ -58,6 +71,15 @@ func tryUnauthorizedGet(url string, config UnauthorizedConfig) {
 func tryAuthorizedPost(url string, config AuthorizedBodyConfig) {
 	tryRequest(url, "POST", config.Body, AuthorizedConfig{
 		Token:   config.Token,
+		Headers: config.Headers,
+		Handler: config.Handler,
+	})
+}
+
+func tryAuthorizedPatch(url string, config AuthorizedBodyConfig) {
+	tryRequest(url, "PATCH", config.Body, AuthorizedConfig{
+		Token:   config.Token,
+		Headers: config.Headers,
 		Handler: config.Handler,
 	})
 }